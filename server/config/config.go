@@ -1,9 +1,14 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -16,8 +21,79 @@ type AppConfig struct {
 	DBPassword string
 	DBName     string
 	DBSSLMode  string
-	JWTSecret  string
+	OTPSecret  string
 	Env        string
+	AppName    string
+	PublicURL  string // externally reachable base URL of this API
+	AdminEmail string // promoted to admin at startup
+
+	// Token signing keys
+	JWTKeysDir   string
+	JWTActiveKID string
+	JWTIssuer    string
+	JWTAudience  string
+
+	// Sessions
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	ReauthTokenTTL  time.Duration // elevated tokens from /auth/reauth
+
+	// Registration
+	RegistrationMode    string   // "open", "invite" or "domain"
+	RegistrationDomains []string // email domains allowed in "domain" mode
+
+	// Password policy
+	PasswordMinLength    int
+	PasswordMinEntropy   int    // estimated bits
+	BreachedPasswordsDir string // hash-prefix files; check skipped when empty
+
+	// Passwordless login
+	MagicLinkURL string // frontend page that posts ?token= to /auth/magic-link/consume
+
+	// New-device login alerts
+	LoginAlertURL string // frontend page that posts ?token= to /auth/login-alert/deny
+
+	// Notification emails
+	NotificationsURL string // frontend notification center, linked from the emails
+
+	// WebAuthn passkeys
+	WebAuthnRPID    string   // domain passkeys are bound to
+	WebAuthnOrigins []string // frontend origins allowed to use them
+
+	// Audit log
+	AuditRetention time.Duration // 0 keeps events forever
+
+	// Account deletion
+	AccountDeletionGrace time.Duration // time to change your mind before the purge
+	AccountPurgeMode     string        // "anonymize" or "delete"
+
+	// OpenID Connect login
+	OIDCProviders       []OIDCProvider
+	OIDCSuccessRedirect string // frontend URL tokens are handed to; JSON response when empty
+
+	// Notifications
+	NotifyEmailDriver string // "smtp" or "log"
+	NotifySMSDriver   string // "http" or "log"
+	NotifyLogFile     string // log driver output; stdout when empty
+	SMTPHost          string
+	SMTPPort          string
+	SMTPUsername      string
+	SMTPPassword      string
+	SMTPFrom          string
+	SMSAPIURL         string
+	SMSAPIKey         string
+	SMSFrom           string
+}
+
+// OIDCProvider is an OpenID Connect issuer configured through
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and
+// OIDC_<NAME>_SCOPES for every name listed in OIDC_PROVIDERS.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
 }
 
 var C AppConfig
@@ -38,9 +114,87 @@ func Load() {
 		DBPassword: getEnv("DB_PASSWORD", "Varun@74358"),
 		DBName:     getEnv("DB_NAME", "BlogAppApplication"),
 		DBSSLMode:  getEnv("DB_SSLMODE", "disable"),
-		JWTSecret:  getEnv("JWT_SECRET", "supersecret"),
+		OTPSecret:  getEnv("OTP_SECRET", ""),
 		Env:        getEnv("ENV", "development"),
+		AppName:    getEnv("APP_NAME", "Blogify"),
+		PublicURL:  getEnv("PUBLIC_URL", "http://localhost:8080"),
+		AdminEmail: getEnv("ADMIN_EMAIL", ""),
+
+		JWTKeysDir:   getEnv("JWT_KEYS_DIR", ""),
+		JWTActiveKID: getEnv("JWT_ACTIVE_KID", ""),
+		JWTIssuer:    getEnv("JWT_ISSUER", "blogify"),
+		JWTAudience:  getEnv("JWT_AUDIENCE", "blogify-api"),
+
+		AccessTokenTTL:  getDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		ReauthTokenTTL:  getDuration("REAUTH_TOKEN_TTL", 5*time.Minute),
+
+		RegistrationMode:    getEnv("REGISTRATION_MODE", "open"),
+		RegistrationDomains: getList("REGISTRATION_DOMAINS", ""),
+
+		PasswordMinLength:    getInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMinEntropy:   getInt("PASSWORD_MIN_ENTROPY", 36),
+		BreachedPasswordsDir: getEnv("BREACHED_PASSWORDS_DIR", ""),
+
+		MagicLinkURL: getEnv("MAGIC_LINK_URL", "http://localhost:5173/magic-link"),
+
+		LoginAlertURL: getEnv("LOGIN_ALERT_URL", "http://localhost:5173/not-me"),
+
+		NotificationsURL: getEnv("NOTIFICATIONS_URL", "http://localhost:5173/notifications"),
+
+		WebAuthnRPID:    getEnv("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnOrigins: getList("WEBAUTHN_ORIGINS", "http://localhost:5173"),
+
+		AuditRetention: getDuration("AUDIT_RETENTION", 365*24*time.Hour),
+
+		AccountDeletionGrace: getDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour),
+		AccountPurgeMode:     getEnv("ACCOUNT_PURGE_MODE", "anonymize"),
+
+		OIDCProviders:       loadOIDCProviders(),
+		OIDCSuccessRedirect: getEnv("OIDC_SUCCESS_REDIRECT", ""),
+
+		NotifyEmailDriver: getEnv("NOTIFY_EMAIL_DRIVER", "log"),
+		NotifySMSDriver:   getEnv("NOTIFY_SMS_DRIVER", "log"),
+		NotifyLogFile:     getEnv("NOTIFY_LOG_FILE", ""),
+		SMTPHost:          getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:          getEnv("SMTP_PORT", "1025"),
+		SMTPUsername:      getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:      getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:          getEnv("SMTP_FROM", "Blogify <no-reply@blogify.local>"),
+		SMSAPIURL:         getEnv("SMS_API_URL", ""),
+		SMSAPIKey:         getEnv("SMS_API_KEY", ""),
+		SMSFrom:           getEnv("SMS_FROM", "Blogify"),
+	}
+
+	if C.OTPSecret == "" {
+		if C.Env == "production" {
+			log.Fatal("OTP_SECRET must be set in production")
+		}
+		log.Println("⚠️  OTP_SECRET not set, using a random secret (pending OTPs won't survive a restart)")
+		C.OTPSecret = randomSecret()
+	}
+
+	switch C.RegistrationMode {
+	case "open", "invite":
+	case "domain":
+		if len(C.RegistrationDomains) == 0 {
+			log.Fatal("REGISTRATION_MODE=domain needs REGISTRATION_DOMAINS")
+		}
+	default:
+		log.Fatalf("REGISTRATION_MODE must be open, invite or domain, got %q", C.RegistrationMode)
+	}
+
+	if C.AccountPurgeMode != "anonymize" && C.AccountPurgeMode != "delete" {
+		log.Fatalf("ACCOUNT_PURGE_MODE must be anonymize or delete, got %q", C.AccountPurgeMode)
+	}
+}
+
+func randomSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal(err)
 	}
+	return hex.EncodeToString(b)
 }
 
 // Helper function to fetch environment variables
@@ -51,6 +205,65 @@ func getEnv(key, def string) string {
 	return def
 }
 
+func loadOIDCProviders() []OIDCProvider {
+	var providers []OIDCProvider
+	for _, name := range strings.Split(getEnv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		p := OIDCProvider{
+			Name:         name,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			log.Fatalf("OIDC provider %q needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		providers = append(providers, p)
+	}
+	return providers
+}
+
+// getDuration parses a time.Duration ("15m", "720h") from the environment
+func getDuration(key string, def time.Duration) time.Duration {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		log.Fatalf("invalid duration for %s: %v", key, err)
+	}
+	return d
+}
+
+func getInt(key string, def int) int {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		log.Fatalf("invalid number for %s: %v", key, err)
+	}
+	return n
+}
+
+// getList reads a comma-separated list
+func getList(key, def string) []string {
+	var list []string
+	for _, v := range strings.Split(getEnv(key, def), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
 // Generate DSN dynamically
 func GetDSN() string {
 	return fmt.Sprintf(
@@ -13,7 +13,8 @@ func ConnectDB() {
 	// Build DSN dynamically from config
 	dsn := GetDSN()
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// TranslateError maps unique violations to gorm.ErrDuplicatedKey
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		log.Fatal("❌ Failed to connect database:", err)
 	}
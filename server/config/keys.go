@@ -0,0 +1,45 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"log"
+
+	"blogapp/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Keys holds the keys access tokens are signed and verified with.
+var Keys *utils.Keyring
+
+// LoadKeys builds Keys from JWT_KEYS_DIR. Outside production a throwaway
+// Ed25519 key is generated when no directory is configured.
+func LoadKeys() {
+	Keys = utils.NewKeyring(C.JWTIssuer, C.JWTAudience)
+
+	if C.JWTKeysDir == "" {
+		if C.Env == "production" {
+			log.Fatal("JWT_KEYS_DIR must be set in production")
+		}
+		log.Println("⚠️  JWT_KEYS_DIR not set, using a temporary signing key (tokens won't survive a restart)")
+
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			log.Fatal(err)
+		}
+		Keys.Add(&utils.SigningKey{ID: "dev", Method: jwt.SigningMethodEdDSA, Private: priv, Public: pub})
+		if err := Keys.SetActive("dev"); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := Keys.LoadKeyDir(C.JWTKeysDir); err != nil {
+		log.Fatal("❌ Failed to load signing keys:", err)
+	}
+	if err := Keys.SetActive(C.JWTActiveKID); err != nil {
+		log.Fatal("❌ JWT_ACTIVE_KID:", err)
+	}
+	log.Println("✅ Signing tokens with key", C.JWTActiveKID)
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"log"
+	"os"
+
+	"blogapp/utils"
+)
+
+// Passwords is the policy new passwords are checked against.
+var Passwords utils.PasswordPolicy
+
+// LoadPasswordPolicy builds Passwords from the config.
+func LoadPasswordPolicy() {
+	Passwords = utils.PasswordPolicy{
+		MinLength:  C.PasswordMinLength,
+		MinEntropy: float64(C.PasswordMinEntropy),
+	}
+
+	if C.BreachedPasswordsDir == "" {
+		return
+	}
+	if fi, err := os.Stat(C.BreachedPasswordsDir); err != nil || !fi.IsDir() {
+		log.Fatal("❌ BREACHED_PASSWORDS_DIR is not a directory: ", C.BreachedPasswordsDir)
+	}
+	Passwords.Breached = &utils.BreachedList{Dir: C.BreachedPasswordsDir}
+	log.Println("✅ Checking new passwords against", C.BreachedPasswordsDir)
+}
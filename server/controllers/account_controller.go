@@ -0,0 +1,418 @@
+package controllers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+	"blogapp/notify"
+	"blogapp/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ===============================
+// Export Personal Data Controller
+// ===============================
+
+type exportBlog struct {
+	ID        uint       `json:"id"`
+	Title     string     `json:"title"`
+	Content   string     `json:"content"`
+	ImageURL  string     `json:"image_url"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type exportComment struct {
+	ID        uint       `json:"id"`
+	BlogID    uint       `json:"blog_id"`
+	Content   string     `json:"content"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type exportLike struct {
+	BlogID    uint      `json:"blog_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportMe streams a zip archive with everything stored about the user:
+// profile.json, blogs.json, comments.json, likes.json and one Markdown file
+// per blog. Soft-deleted blogs and comments are included, since they are
+// still in the database.
+func ExportMe(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var blogs []exportBlog
+	var comments []exportComment
+	var likes []exportLike
+	var identities []models.UserIdentity
+	var sessions []models.Session
+	var tokens []models.PersonalAccessToken
+	var logins []models.LoginEvent
+	var following []models.Follow
+	var notificationPrefs []models.NotificationPreference
+	var blocks []models.Block
+	var mutes []models.Mute
+	err := errors.Join(
+		config.DB.Unscoped().Model(&models.Blog{}).Where("author_id = ?", uid).Order("id").Find(&blogs).Error,
+		config.DB.Unscoped().Model(&models.Comment{}).Where("user_id = ?", uid).Order("id").Find(&comments).Error,
+		config.DB.Model(&models.Like{}).Where("user_id = ?", uid).Order("id").Find(&likes).Error,
+		config.DB.Where("user_id = ?", uid).Find(&identities).Error,
+		config.DB.Where("user_id = ?", uid).Order("id").Find(&sessions).Error,
+		config.DB.Where("user_id = ?", uid).Order("id").Find(&tokens).Error,
+		config.DB.Where("user_id = ?", uid).Order("id").Find(&logins).Error,
+		config.DB.Where("follower_id = ?", uid).Order("id").Find(&following).Error,
+		config.DB.Where("user_id = ?", uid).Find(&notificationPrefs).Error,
+		config.DB.Where("blocker_id = ?", uid).Order("id").Find(&blocks).Error,
+		config.DB.Where("muter_id = ?", uid).Order("id").Find(&mutes).Error,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		return
+	}
+
+	filename := fmt.Sprintf("%s-export-%d-%s.zip", strings.ToLower(config.C.AppName), uid, time.Now().Format("2006-01-02"))
+	audit(c, "account.export", uid, auditTarget("user", uid), auditSuccess, "")
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", gin.H{
+			"user":       user.Self(),
+			"identities": identities,
+			"sessions":   sessions,
+			"tokens":     tokens,
+			"logins":     logins,
+			"following":  following,
+			"blocks":     blocks,
+			"mutes":      mutes,
+
+			"notification_preferences": notificationPrefs,
+		}},
+		{"blogs.json", blogs},
+		{"comments.json", comments},
+		{"likes.json", likes},
+	}
+	for _, f := range files {
+		if err = writeJSON(zw, f.name, f.data); err != nil {
+			break
+		}
+	}
+	for _, b := range blogs {
+		if err != nil {
+			break
+		}
+		err = writeFile(zw, fmt.Sprintf("blogs/%d-%s.md", b.ID, slug(b.Title)), blogMarkdown(b))
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	// Headers are already sent, so all that's left is to log it
+	if err != nil {
+		log.Println("export failed:", err)
+	}
+}
+
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(zw, name, string(b))
+}
+
+func writeFile(zw *zip.Writer, name, content string) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, content)
+	return err
+}
+
+func blogMarkdown(b exportBlog) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", b.Title)
+	fmt.Fprintf(&sb, "_Published %s_\n\n", b.CreatedAt.Format("2006-01-02 15:04"))
+	if b.ImageURL != "" {
+		fmt.Fprintf(&sb, "![](%s)\n\n", b.ImageURL)
+	}
+	sb.WriteString(b.Content)
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// slug turns a title into something safe to use in a file name.
+func slug(title string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+			dash = false
+		} else if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+			dash = true
+		}
+		if sb.Len() >= 50 {
+			break
+		}
+	}
+	s := strings.TrimRight(sb.String(), "-")
+	if s == "" {
+		return "untitled"
+	}
+	return s
+}
+
+// ===============================
+// Delete Account Controller
+// ===============================
+
+// DeleteMe schedules the account for deletion after the grace period and
+// logs the user out everywhere. Accounts with a password have to confirm
+// it; accounts created through social login have none.
+func DeleteMe(c *gin.Context) {
+	type DeleteDTO struct {
+		Password string `json:"password"`
+	}
+	var body DeleteDTO
+	if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := c.MustGet("userID").(uint)
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.Password != "" {
+		keys := throttleKeys(c, "", &user)
+		if checkLockout(c, keys) {
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.Password)) != nil {
+			recordFailure(c, keys, &user)
+			audit(c, "account.delete_request", user.ID, auditTarget("user", user.ID), auditFailure, "wrong password")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+			return
+		}
+		clearFailures(keys)
+	}
+
+	deleteAfter := time.Now().Add(config.C.AccountDeletionGrace)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("delete_after", deleteAfter).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.PersonalAccessToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	audit(c, "account.delete_request", user.ID, auditTarget("user", user.ID), auditSuccess,
+		"delete after "+deleteAfter.Format(time.RFC3339))
+
+	err = notify.SendTemplate(c.Request.Context(), notify.Email, user.Email, "account_deletion", gin.H{
+		"Name":        user.FirstName,
+		"DeleteAfter": deleteAfter.Format("January 2, 2006"),
+	})
+	if err != nil {
+		log.Println("deletion notice failed:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Your account will be deleted. Log in again before then to cancel.",
+		"delete_after": deleteAfter,
+	})
+}
+
+// cancelDeletion withdraws a pending deletion request. It runs whenever the
+// user logs in, which is how a deletion is cancelled.
+func cancelDeletion(user models.User) bool {
+	if user.DeleteAfter == nil {
+		return false
+	}
+	res := config.DB.Model(&user).Where("delete_after IS NOT NULL").Update("delete_after", nil)
+	return res.Error == nil && res.RowsAffected > 0
+}
+
+// ===============================
+// Account Purge Job
+// ===============================
+
+// StartAccountPurger purges accounts whose grace period has ended every
+// interval.
+func StartAccountPurger(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			purgeAccounts()
+		}
+	}()
+}
+
+func purgeAccounts() {
+	var ids []uint
+	config.DB.Model(&models.User{}).Where("delete_after <= ?", time.Now()).Pluck("id", &ids)
+	for _, id := range ids {
+		if err := purgeAccount(id, config.C.AccountPurgeMode); err != nil {
+			log.Printf("purging user %d failed: %v", id, err)
+			continue
+		}
+		log.Printf("✅ purged user %d (%s)", id, config.C.AccountPurgeMode)
+	}
+}
+
+// purgeAccount removes a user for good. In "delete" mode the user row is
+// hard-deleted along with their blogs, comments and likes, and the cascade
+// constraints take the rest. In "anonymize" mode their posts and comments
+// stay up: everything identifying is scrubbed from the user row, which is
+// then soft-deleted so it can't be found or logged into again.
+func purgeAccount(id uint, mode string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		// Someone may have logged in and cancelled since the ids were read
+		var user models.User
+		if err := tx.Where("delete_after <= ?", time.Now()).First(&user, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		// No request here, so the event is written directly and has no
+		// actor: the system did this, not the user.
+		ev := models.AuditEvent{
+			Action:  "account.purge",
+			Target:  auditTarget("user", user.ID),
+			Outcome: auditSuccess,
+			Detail:  mode,
+		}
+		if err := tx.Create(&ev).Error; err != nil {
+			return err
+		}
+
+		if mode == "delete" {
+			return hardDeleteUser(tx, user.ID)
+		}
+		return anonymizeUser(tx, user.ID)
+	})
+}
+
+func hardDeleteUser(tx *gorm.DB, id uint) error {
+	ownBlogs := tx.Unscoped().Model(&models.Blog{}).Select("id").Where("author_id = ?", id)
+
+	// blogs.likes/comments aren't declared with ON DELETE CASCADE, so other
+	// people's likes and comments on the user's blogs go first.
+	if err := tx.Where("user_id = ? OR blog_id IN (?)", id, ownBlogs).Delete(&models.Like{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("user_id = ? OR blog_id IN (?)", id, ownBlogs).Delete(&models.Comment{}).Error; err != nil {
+		return err
+	}
+	err := tx.Model(&models.Blog{}).Where("? = ANY(liked_by)", id).
+		UpdateColumn("liked_by", gorm.Expr("array_remove(liked_by, ?)", id)).Error
+	if err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("author_id = ?", id).Delete(&models.Blog{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&models.User{}, id).Error
+}
+
+func anonymizeUser(tx *gorm.DB, id uint) error {
+	for _, m := range []interface{}{
+		&models.Session{},
+		&models.PersonalAccessToken{},
+		&models.UserIdentity{},
+		&models.WebAuthnCredential{},
+		&models.RecoveryCode{},
+		&models.OTPCode{},
+		&models.LoginEvent{},
+		&models.Notification{},
+		&models.NotificationPreference{},
+	} {
+		if err := tx.Where("user_id = ?", id).Delete(m).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("follower_id = ? OR followee_id = ?", id, id).Delete(&models.Follow{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("blocker_id = ? OR blocked_id = ?", id, id).Delete(&models.Block{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("muter_id = ? OR muted_id = ?", id, id).Delete(&models.Mute{}).Error; err != nil {
+		return err
+	}
+
+	err := tx.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"first_name":      "Deleted",
+		"last_name":       "user",
+		"email":           fmt.Sprintf("deleted-%d@users.invalid", id), // frees the address, keeps the index unique
+		"phone":           "",
+		"password":        "",
+		"bio":             "",
+		"is_otp_verified": false,
+		"phone_verified":  false,
+		"role":            utils.RoleReader,
+		"permissions":     pq.StringArray{},
+		"totp_secret":     "",
+		"totp_enabled":    false,
+		"delete_after":    nil,
+
+		"handle":       "",
+		"avatar_url":   "",
+		"cover_url":    "",
+		"website":      "",
+		"location":     "",
+		"social_links": pq.StringArray{},
+
+		"privacy_show_email": false,
+		"privacy_show_phone": false,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Delete(&models.User{}, id).Error
+}
+
+// withDeleted is used to preload authors, so posts and comments of
+// anonymized (soft-deleted) accounts still show "Deleted user".
+func withDeleted(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
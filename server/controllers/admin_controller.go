@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+	"blogapp/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// pagination reads ?page and ?limit the same way GetBlogs does.
+func pagination(c *gin.Context) (page, limit, offset int) {
+	page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ = strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 50 {
+		limit = 10
+	}
+	return page, limit, (page - 1) * limit
+}
+
+// ===============================
+// Admin: Users
+// ===============================
+func AdminListUsers(c *gin.Context) {
+	page, limit, offset := pagination(c)
+
+	q := config.DB.Model(&models.User{})
+	if search := c.Query("q"); search != "" {
+		like := "%" + search + "%"
+		q = q.Where("email ILIKE ? OR phone ILIKE ? OR first_name ILIKE ? OR last_name ILIKE ?", like, like, like, like)
+	}
+	if role := c.Query("role"); role != "" {
+		q = q.Where("role = ?", role)
+	}
+	if invite := c.Query("invite_id"); invite != "" {
+		q = q.Where("invite_id = ?", invite)
+	}
+
+	var total int64
+	var users []models.User
+	q.Count(&total)
+	q.Order("id asc").Limit(limit).Offset(offset).Find(&users)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  models.AdminUsers(users),
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+func AdminGetUser(c *gin.Context) {
+	var user models.User
+	if err := config.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": user.Admin()})
+}
+
+func AdminUpdateRole(c *gin.Context) {
+	type RoleDTO struct {
+		Role        string   `json:"role" binding:"required"`
+		Permissions []string `json:"permissions"`
+	}
+
+	var body RoleDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !utils.ValidRole(body.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role " + body.Role})
+		return
+	}
+	for _, p := range body.Permissions {
+		if !utils.ValidPermission(p) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown permission " + p})
+			return
+		}
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	// Keeps the last admin from locking everyone out by accident
+	if user.ID == c.MustGet("userID").(uint) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you can't change your own role"})
+		return
+	}
+
+	perms := pq.StringArray(body.Permissions)
+	if perms == nil {
+		perms = pq.StringArray{}
+	}
+	if err := config.DB.Model(&user).Updates(map[string]interface{}{
+		"role":        body.Role,
+		"permissions": perms,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update role"})
+		return
+	}
+	audit(c, "admin.role_update", c.MustGet("userID").(uint), auditTarget("user", user.ID), auditSuccess,
+		fmt.Sprintf("role %s -> %s, permissions %v", user.Role, body.Role, body.Permissions))
+	user.Role = body.Role
+	user.Permissions = perms
+
+	c.JSON(http.StatusOK, gin.H{"user": user.Admin()})
+}
+
+// AdminRevokeSessions logs a user out everywhere, e.g. after a role
+// downgrade that shouldn't wait for their access tokens to expire.
+func AdminRevokeSessions(c *gin.Context) {
+	var user models.User
+	if err := config.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err := revokeSessions("user_id = ?", user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+		return
+	}
+	audit(c, "admin.revoke_sessions", c.MustGet("userID").(uint), auditTarget("user", user.ID), auditSuccess, "")
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// ===============================
+// Admin: Security Log
+// ===============================
+func AdminSecurityEvents(c *gin.Context) {
+	page, limit, offset := pagination(c)
+
+	q := config.DB.Model(&models.SecurityEvent{})
+	if kind := c.Query("kind"); kind != "" {
+		q = q.Where("kind = ?", kind)
+	}
+	if uid := c.Query("user_id"); uid != "" {
+		q = q.Where("user_id = ?", uid)
+	}
+
+	var total int64
+	var events []models.SecurityEvent
+	q.Count(&total)
+	q.Order("created_at desc").Limit(limit).Offset(offset).Find(&events)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  events,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// ===============================
+// Admin: Audit Log
+// ===============================
+
+// AdminAuditEvents lists the audit log, newest first. since and until take
+// RFC 3339 times.
+func AdminAuditEvents(c *gin.Context) {
+	page, limit, offset := pagination(c)
+
+	q := config.DB.Model(&models.AuditEvent{})
+	for _, f := range []string{"action", "actor_id", "target", "outcome", "ip"} {
+		if v := c.Query(f); v != "" {
+			q = q.Where(f+" = ?", v)
+		}
+	}
+	for _, f := range []struct{ param, cond string }{{"since", "created_at >= ?"}, {"until", "created_at < ?"}} {
+		v := c.Query(f.param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": f.param + " must be an RFC 3339 time"})
+			return
+		}
+		q = q.Where(f.cond, t)
+	}
+
+	var total int64
+	var events []models.AuditEvent
+	q.Count(&total)
+	q.Order("created_at desc, id desc").Limit(limit).Offset(offset).Find(&events)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  events,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Audit event outcomes
+const (
+	auditSuccess = "success"
+	auditFailure = "failure"
+)
+
+// audit appends an event to the audit log. actorID is the user acting, or
+// 0 when unknown (e.g. a login for a made-up account). A failed write is
+// logged but never fails the request.
+func audit(c *gin.Context, action string, actorID uint, target, outcome, detail string) {
+	ev := models.AuditEvent{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Action:    action,
+		Target:    target,
+		Outcome:   outcome,
+		Detail:    detail,
+	}
+	if actorID != 0 {
+		ev.ActorID = &actorID
+	}
+	if err := config.DB.Create(&ev).Error; err != nil {
+		log.Println("audit write failed:", err)
+	}
+}
+
+// auditTarget formats an audit target such as "blog:12".
+func auditTarget(kind string, id uint) string {
+	return fmt.Sprintf("%s:%d", kind, id)
+}
+
+// InstallAuditGuard makes audit_events append-only at the database level:
+// updates are always refused, and deletes only go through inside a
+// transaction that set blogapp.audit_purge, which only the retention job
+// does.
+func InstallAuditGuard() error {
+	return config.DB.Exec(`
+CREATE OR REPLACE FUNCTION audit_events_guard() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'DELETE' AND current_setting('blogapp.audit_purge', true) = 'on' THEN
+		RETURN OLD;
+	END IF;
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_guard ON audit_events;
+CREATE TRIGGER audit_events_guard BEFORE UPDATE OR DELETE ON audit_events
+	FOR EACH ROW EXECUTE FUNCTION audit_events_guard();
+`).Error
+}
+
+// StartAuditRetention deletes audit events older than AUDIT_RETENTION every
+// interval. A retention of 0 keeps them forever.
+func StartAuditRetention(interval time.Duration) {
+	if config.C.AuditRetention <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			purgeAuditEvents()
+		}
+	}()
+}
+
+func purgeAuditEvents() {
+	cutoff := time.Now().Add(-config.C.AuditRetention)
+	var n int64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SET LOCAL blogapp.audit_purge = 'on'").Error; err != nil {
+			return err
+		}
+		res := tx.Where("created_at < ?", cutoff).Delete(&models.AuditEvent{})
+		n = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		log.Println("audit retention failed:", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("✅ removed %d audit events older than %s", n, config.C.AuditRetention)
+	}
+}
@@ -1,28 +1,29 @@
 package controllers
 
 import (
-	"fmt"
-	"math/rand"
+	"log"
 	"net/http"
-	"time"
 
 	"blogapp/config"
 	"blogapp/models"
+	"blogapp/notify"
 	"blogapp/utils"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // ===============================
 // Register Controller
 // ===============================
 type RegisterDTO struct {
-	FirstName string `json:"first_name" binding:"required"`
-	LastName  string `json:"last_name" binding:"required"`
-	Email     string `json:"email" binding:"required,email"`
-	Password  string `json:"password" binding:"required,min=6"`
-	Phone     string `json:"phone" binding:"required"`
+	FirstName  string `json:"first_name" binding:"required"`
+	LastName   string `json:"last_name" binding:"required"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required"`
+	Phone      string `json:"phone" binding:"required"`
+	InviteCode string `json:"invite_code"`
 }
 
 func Register(c *gin.Context) {
@@ -32,6 +33,14 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	// Cheap checks first; the invite is only redeemed along with the insert
+	if admissionFailed(c, emailAllowed(body.Email, body.InviteCode != "")) {
+		return
+	}
+	if !checkNewPassword(c, "password", body.Password, body.FirstName, body.LastName, body.Email, body.Phone) {
+		return
+	}
+
 	// Check if user exists
 	var existingUser models.User
 	if err := config.DB.Where("email = ? OR phone = ?", body.Email, body.Phone).First(&existingUser).Error; err == nil {
@@ -42,10 +51,6 @@ func Register(c *gin.Context) {
 	// Hash password
 	hash, _ := bcrypt.GenerateFromPassword([]byte(body.Password), 12)
 
-	// Generate OTP
-	otp := fmt.Sprintf("%06d", rand.Intn(1000000))
-	expires := time.Now().Add(5 * time.Minute)
-
 	// Create new user
 	user := models.User{
 		FirstName:     body.FirstName,
@@ -53,17 +58,33 @@ func Register(c *gin.Context) {
 		Email:         body.Email,
 		Phone:         body.Phone,
 		Password:      string(hash),
-		OTPCode:       otp,
-		OTPExpires:    expires,
 		IsOTPVerified: false,
 	}
 
-	if err := config.DB.Create(&user).Error; err != nil {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		inviteID, err := admitNewUser(tx, body.Email, body.InviteCode)
+		if err != nil {
+			return err
+		}
+		user.InviteID = inviteID
+		return tx.Create(&user).Error
+	})
+	if admissionFailed(c, err) {
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create user"})
 		return
 	}
 
-	fmt.Println("Registration OTP:", otp) // For testing
+	otp, err := issueOTP(user.ID, models.OTPVerifyEmail, "")
+	if err == nil {
+		err = sendOTP(c, user, notify.Email, otp, models.OTPVerifyEmail)
+	}
+	if err != nil {
+		log.Println("registration OTP delivery failed:", err)
+	}
+	audit(c, "auth.register", user.ID, auditTarget("user", user.ID), auditSuccess, "")
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "User registered successfully. Please verify OTP.",
@@ -75,8 +96,9 @@ func Register(c *gin.Context) {
 // ===============================
 func VerifyOTP(c *gin.Context) {
 	type VerifyDTO struct {
-		EmailOrPhone string `json:"email_or_phone" binding:"required"`
-		OTP          string `json:"otp" binding:"required"`
+		EmailOrPhone string            `json:"email_or_phone" binding:"required"`
+		OTP          string            `json:"otp" binding:"required"`
+		Purpose      models.OTPPurpose `json:"purpose" binding:"omitempty,oneof=verify_email verify_phone"`
 	}
 
 	var body VerifyDTO
@@ -84,41 +106,75 @@ func VerifyOTP(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if body.Purpose == "" {
+		body.Purpose = models.OTPVerifyEmail
+	}
 
-	// Find user
-	var user models.User
-	if err := config.DB.Where("email = ? OR phone = ?", body.EmailOrPhone, body.EmailOrPhone).First(&user).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	user, ok := checkOTPFor(c, body.EmailOrPhone, body.Purpose, body.OTP)
+	if !ok {
 		return
 	}
 
-	if user.IsOTPVerified {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User already verified"})
-		return
+	verifiedField := "is_otp_verified"
+	if body.Purpose == models.OTPVerifyPhone {
+		verifiedField = "phone_verified"
+	}
+	config.DB.Model(&user).Update(verifiedField, true)
+	audit(c, "auth.verify", user.ID, auditTarget("user", user.ID), auditSuccess, string(body.Purpose))
+
+	c.JSON(http.StatusOK, gin.H{"message": "OTP verified successfully"})
+}
+
+// ===============================
+// Resend OTP Controller
+// ===============================
+func ResendOTP(c *gin.Context) {
+	type ResendDTO struct {
+		EmailOrPhone string            `json:"email_or_phone" binding:"required"`
+		Purpose      models.OTPPurpose `json:"purpose" binding:"required,oneof=verify_email verify_phone reset_password"`
 	}
 
-	if time.Now().After(user.OTPExpires) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "OTP expired"})
+	var body ResendDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if user.OTPCode != body.OTP {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OTP"})
+	// Every outcome that depends on the account gets the same answer so the
+	// endpoint can't be used to find out which accounts exist.
+	user, err := findByIdentifier(body.EmailOrPhone)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": msgOTPSent})
 		return
 	}
 
-	config.DB.Model(&user).Updates(map[string]interface{}{
-		"is_otp_verified": true,
-		"otp_code":        "",
-		"otp_expires":     time.Time{},
-	})
+	ch := notify.Email
+	switch body.Purpose {
+	case models.OTPVerifyEmail:
+		if user.IsOTPVerified {
+			c.JSON(http.StatusOK, gin.H{"message": msgOTPSent})
+			return
+		}
+	case models.OTPVerifyPhone:
+		if user.PhoneVerified {
+			c.JSON(http.StatusOK, gin.H{"message": msgOTPSent})
+			return
+		}
+		ch = notify.SMS
+	case models.OTPResetPassword:
+		if body.EmailOrPhone == user.Phone {
+			ch = notify.SMS
+		}
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "OTP verified successfully"})
+	deliverOTP(c, user, ch, body.Purpose)
 }
 
 // ===============================
 // Login Controller
 // ===============================
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), 12)
+
 type LoginDTO struct {
 	EmailOrPhone string `json:"email_or_phone" binding:"required"`
 	Password     string `json:"password" binding:"required"`
@@ -131,28 +187,89 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := config.DB.Where("email = ? OR phone = ?", body.EmailOrPhone, body.EmailOrPhone).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email/phone or password"})
+	var found *models.User
+	user, err := findByIdentifier(body.EmailOrPhone)
+	if err == nil {
+		found = &user
+	}
+
+	keys := throttleKeys(c, body.EmailOrPhone, found)
+	if checkLockout(c, keys) {
 		return
 	}
 
-	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.Password)) != nil {
+	// Unknown accounts still pay for a bcrypt comparison so response times
+	// don't reveal which accounts exist.
+	hash := dummyPasswordHash
+	if found != nil {
+		hash = []byte(user.Password)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(body.Password)) != nil || found == nil {
+		recordFailure(c, keys, found)
+		if found != nil {
+			loginFailed(c, user.ID, "password", "wrong password")
+		} else {
+			audit(c, "auth.login", 0, "identifier:"+body.EmailOrPhone, auditFailure, "password: unknown account")
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email/phone or password"})
 		return
 	}
+	clearFailures(keys)
 
 	if !user.IsOTPVerified {
+		loginFailed(c, user.ID, "password", "not verified")
 		c.JSON(http.StatusForbidden, gin.H{"error": "OTP verification required"})
 		return
 	}
+	if user.PasswordResetRequired {
+		loginFailed(c, user.ID, "password", "password reset required")
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":                   "Please reset your password before logging in with it",
+			"password_reset_required": true,
+		})
+		return
+	}
 
-	token, _ := utils.GenerateJWT(config.C.JWTSecret, user.ID)
+	res, err := loginResponse(c, user, "password")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"token":   token,
-	})
+	c.JSON(http.StatusOK, res)
+}
+
+// loginResponse finishes a successful first-factor login. Users with 2FA
+// (a TOTP app or a passkey) get a challenge token to exchange at
+// /auth/2fa/verify or /auth/2fa/webauthn/verify; everyone else gets a new
+// session straight away.
+func loginResponse(c *gin.Context, user models.User, method string) (gin.H, error) {
+	var methods []string
+	if user.TOTPEnabled {
+		methods = append(methods, "totp")
+	}
+	if hasPasskey(user.ID) {
+		methods = append(methods, "webauthn")
+	}
+	if len(methods) > 0 {
+		challenge, err := utils.GenerateChallengeToken(config.Keys, user.ID, twoFactorChallenge, twoFactorChallengeTTL)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{
+			"message":             "Two-factor authentication required",
+			"two_factor_required": true,
+			"two_factor_methods":  methods,
+			"challenge_token":     challenge,
+		}, nil
+	}
+
+	tokens, err := issueTokens(c, user, method)
+	if err != nil {
+		return nil, err
+	}
+	tokens["message"] = "Login successful"
+	return tokens, nil
 }
 
 // ===============================
@@ -169,24 +286,17 @@ func ForgotPassword(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := config.DB.Where("email = ? OR phone = ?", body.EmailOrPhone, body.EmailOrPhone).First(&user).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	user, err := findByIdentifier(body.EmailOrPhone)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": msgOTPSent})
 		return
 	}
 
-	// Generate new OTP
-	otp := fmt.Sprintf("%06d", rand.Intn(1000000))
-	expires := time.Now().Add(5 * time.Minute)
-
-	config.DB.Model(&user).Updates(map[string]interface{}{
-		"otp_code":    otp,
-		"otp_expires": expires,
-	})
-
-	fmt.Println("Password Reset OTP:", otp) // For testing
-
-	c.JSON(http.StatusOK, gin.H{"message": "OTP sent successfully"})
+	ch := notify.Email
+	if body.EmailOrPhone == user.Phone {
+		ch = notify.SMS
+	}
+	deliverOTP(c, user, ch, models.OTPResetPassword)
 }
 
 // ===============================
@@ -196,7 +306,7 @@ func ResetPassword(c *gin.Context) {
 	type ResetDTO struct {
 		EmailOrPhone string `json:"email_or_phone" binding:"required"`
 		OTP          string `json:"otp" binding:"required"`
-		Password     string `json:"password" binding:"required,min=6"`
+		Password     string `json:"password" binding:"required"`
 	}
 
 	var body ResetDTO
@@ -205,31 +315,32 @@ func ResetPassword(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := config.DB.Where("email = ? OR phone = ?", body.EmailOrPhone, body.EmailOrPhone).First(&user).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	// Checked before the OTP so a rejected password doesn't use up the
+	// code. The user's name is only known once the OTP proves who's asking.
+	if !checkNewPassword(c, "password", body.Password, body.EmailOrPhone) {
 		return
 	}
 
-	if time.Now().After(user.OTPExpires) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "OTP expired"})
+	user, ok := checkOTPFor(c, body.EmailOrPhone, models.OTPResetPassword, body.OTP)
+	if !ok {
 		return
 	}
-
-	if user.OTPCode != body.OTP {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OTP"})
+	if !checkNewPassword(c, "password", body.Password, personalInfo(user)...) {
 		return
 	}
 
 	// Encrypt and update new password
 	hash, _ := bcrypt.GenerateFromPassword([]byte(body.Password), 12)
 	config.DB.Model(&user).Updates(map[string]interface{}{
-		"password":     string(hash),
-		"otp_code":     "",
-		"otp_expires":  time.Time{},
-		"is_otp_verified": true, // optional: mark verified after password reset
+		"password":                string(hash),
+		"is_otp_verified":         true, // optional: mark verified after password reset
+		"password_reset_required": false,
 	})
 
+	// A reset usually means the old password can't be trusted anymore
+	revokeSessions("user_id = ?", user.ID)
+	audit(c, "auth.password_reset", user.ID, auditTarget("user", user.ID), auditSuccess, "")
+
 	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
 }
 
@@ -243,7 +354,7 @@ func Me(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"user": user})
+	c.JSON(http.StatusOK, gin.H{"user": user.Self()})
 }
 
 
@@ -262,6 +373,6 @@ func GetUserByID(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User fetched successfully",
-		"user":    user,
+		"user":    user.Public(),
 	})
 }
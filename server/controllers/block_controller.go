@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// isBlocked reports whether owner has blocked uid.
+func isBlocked(owner, uid uint) bool {
+	var n int64
+	config.DB.Model(&models.Block{}).Where("blocker_id = ? AND blocked_id = ?", owner, uid).Count(&n)
+	return n > 0
+}
+
+// isMuted reports whether owner has muted uid.
+func isMuted(owner, uid uint) bool {
+	var n int64
+	config.DB.Model(&models.Mute{}).Where("muter_id = ? AND muted_id = ?", owner, uid).Count(&n)
+	return n > 0
+}
+
+// mutedBy is a subquery of the users uid has muted, for "NOT IN (?)".
+func mutedBy(uid uint) *gorm.DB {
+	return config.DB.Model(&models.Mute{}).Select("muted_id").Where("muter_id = ?", uid)
+}
+
+// withoutMuted hides the rows of users the viewer of an OptionalAuth route
+// has muted. column holds the row's user id.
+func withoutMuted(c *gin.Context, q *gorm.DB, column string) *gorm.DB {
+	uid, ok := c.Get("userID")
+	if !ok {
+		return q
+	}
+	return q.Where(column+" NOT IN (?)", mutedBy(uid.(uint)))
+}
+
+// relationTarget loads the user of /users/:ref/block or /mute, who can't be
+// the caller. It answers the request and returns false on failure.
+func relationTarget(c *gin.Context, action string) (models.User, bool) {
+	user, err := findUserByRef(c.Param("ref"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return user, false
+	}
+	if user.ID == c.MustGet("userID").(uint) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't " + action + " yourself"})
+		return user, false
+	}
+	return user, true
+}
+
+type relationEntry struct {
+	User  models.PublicUser `json:"user"`
+	Since time.Time         `json:"since"`
+}
+
+// listRelations pages through the caller's rows of a block or mute table,
+// most recent first, and returns the other users.
+func listRelations(c *gin.Context, model interface{}, ownerColumn, otherColumn string) {
+	uid := c.MustGet("userID").(uint)
+	page, limit, offset := pagination(c)
+
+	q := config.DB.Model(model).Where(ownerColumn+" = ?", uid)
+	var total int64
+	var rows []struct {
+		OtherID   uint
+		CreatedAt time.Time
+	}
+	q.Count(&total)
+	q.Select(otherColumn + " AS other_id, created_at").Order("created_at desc, id desc").Limit(limit).Offset(offset).Scan(&rows)
+
+	ids := make([]uint, len(rows))
+	for i, r := range rows {
+		ids[i] = r.OtherID
+	}
+	var users []models.User
+	if len(ids) > 0 {
+		config.DB.Where("id IN ?", ids).Find(&users)
+	}
+	byID := map[uint]models.User{}
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	data := make([]relationEntry, 0, len(rows))
+	for _, r := range rows {
+		if u, ok := byID[r.OtherID]; ok {
+			data = append(data, relationEntry{User: u.Public(), Since: r.CreatedAt})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  data,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// ===============================
+// Block Controllers
+// ===============================
+
+// BlockUser also ends any follow between the two users; the blocked user
+// can't follow again until unblocked.
+func BlockUser(c *gin.Context) {
+	user, ok := relationTarget(c, "block")
+	if !ok {
+		return
+	}
+	uid := c.MustGet("userID").(uint)
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		block := models.Block{BlockerID: uid, BlockedID: user.ID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&block).Error; err != nil {
+			return err
+		}
+		return tx.Where("(follower_id = ? AND followee_id = ?) OR (follower_id = ? AND followee_id = ?)", uid, user.ID, user.ID, uid).
+			Delete(&models.Follow{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"blocked": true})
+}
+
+func UnblockUser(c *gin.Context) {
+	user, ok := relationTarget(c, "unblock")
+	if !ok {
+		return
+	}
+	uid := c.MustGet("userID").(uint)
+
+	if err := config.DB.Where("blocker_id = ? AND blocked_id = ?", uid, user.ID).Delete(&models.Block{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unblock user"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"blocked": false})
+}
+
+func GetMyBlocks(c *gin.Context) {
+	listRelations(c, &models.Block{}, "blocker_id", "blocked_id")
+}
+
+// ===============================
+// Mute Controllers
+// ===============================
+func MuteUser(c *gin.Context) {
+	user, ok := relationTarget(c, "mute")
+	if !ok {
+		return
+	}
+	mute := models.Mute{MuterID: c.MustGet("userID").(uint), MutedID: user.ID}
+	if err := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&mute).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mute user"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"muted": true})
+}
+
+func UnmuteUser(c *gin.Context) {
+	user, ok := relationTarget(c, "unmute")
+	if !ok {
+		return
+	}
+	uid := c.MustGet("userID").(uint)
+
+	if err := config.DB.Where("muter_id = ? AND muted_id = ?", uid, user.ID).Delete(&models.Mute{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unmute user"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"muted": false})
+}
+
+func GetMyMutes(c *gin.Context) {
+	listRelations(c, &models.Mute{}, "muter_id", "muted_id")
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -9,11 +10,43 @@ import (
 	"blogapp/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// can reports whether the authenticated user has perm
+func can(c *gin.Context, perm string) bool {
+	return utils.HasPermission(c.GetString("role"), c.GetStringSlice("permissions"), perm)
+}
+
+// canModify reports whether the user may change blog: authors need the
+// ":own" permission for their own posts, anyone else the ":any" one.
+func canModify(c *gin.Context, blog models.Blog, ownPerm, anyPerm string) bool {
+	if blog.AuthorID == c.MustGet("userID").(uint) && can(c, ownPerm) {
+		return true
+	}
+	return can(c, anyPerm)
+}
+
+// published limits a blog query to the posts everyone can see.
+func published(db *gorm.DB) *gorm.DB {
+	return db.Where("status = ?", models.BlogPublished)
+}
+
+// visibleBlogs limits a blog query to published posts plus, when the
+// request is authenticated, the caller's own drafts.
+func visibleBlogs(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if uid, ok := c.Get("userID"); ok {
+			return db.Where("(status = ? OR author_id = ?)", models.BlogPublished, uid)
+		}
+		return published(db)
+	}
+}
+
 type BlogDTO struct {
 	Title   string `json:"title" binding:"required"`
 	Content string `json:"content" binding:"required"`
+	Status  string `json:"status" binding:"omitempty,oneof=draft published"` // unchanged when empty
 }
 
 func CreateBlog(c *gin.Context) {
@@ -22,11 +55,16 @@ func CreateBlog(c *gin.Context) {
 	// ✅ Parse form data
 	title := c.PostForm("title")
 	content := c.PostForm("content")
+	status := c.DefaultPostForm("status", models.BlogPublished)
 
 	if title == "" || content == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Title and content are required"})
 		return
 	}
+	if status != models.BlogPublished && status != models.BlogDraft {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be draft or published"})
+		return
+	}
 
 	var imageURL string
 	file, fileHeader, err := c.Request.FormFile("image")
@@ -46,12 +84,16 @@ func CreateBlog(c *gin.Context) {
 		Content:  content,
 		ImageURL: imageURL,
 		AuthorID: uid,
+		Status:   status,
 	}
 
 	if err := config.DB.Create(&blog).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create blog"})
 		return
 	}
+	if blog.Status == models.BlogPublished {
+		notifyMentions(blog.Content, "", uid, &blog, nil, 0)
+	}
 
 	c.JSON(http.StatusCreated, gin.H{"blog": blog})
 }
@@ -71,8 +113,9 @@ func GetBlogs(c *gin.Context) {
 	var blogs []models.Blog
 	var total int64
 
-	config.DB.Model(&models.Blog{}).Count(&total)
-	config.DB.Preload("Author").Order("created_at desc").Limit(limit).Offset(offset).Find(&blogs)
+	q := withoutMuted(c, config.DB.Model(&models.Blog{}).Scopes(published), "author_id")
+	q.Count(&total)
+	q.Preload("Author", withDeleted).Order("created_at desc").Limit(limit).Offset(offset).Find(&blogs)
 
 	type likeCount struct {
 		BlogID uint
@@ -98,7 +141,7 @@ func GetBlogs(c *gin.Context) {
 func GetBlog(c *gin.Context) {
 	id := c.Param("id")
 	var blog models.Blog
-	if err := config.DB.Preload("Author").First(&blog, id).Error; err != nil {
+	if err := config.DB.Scopes(visibleBlogs(c)).Preload("Author", withDeleted).First(&blog, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error":"not found"})
 		return
 	}
@@ -109,13 +152,12 @@ func GetBlog(c *gin.Context) {
 
 func UpdateBlog(c *gin.Context) {
 	id := c.Param("id")
-	uid := c.MustGet("userID").(uint)
 	var blog models.Blog
 	if err := config.DB.First(&blog, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error":"not found"})
 		return
 	}
-	if blog.AuthorID != uid {
+	if !canModify(c, blog, utils.PermBlogsUpdateOwn, utils.PermBlogsUpdateAny) {
 		c.JSON(http.StatusForbidden, gin.H{"error":"not owner"})
 		return
 	}
@@ -124,24 +166,38 @@ func UpdateBlog(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// Mentions in a draft only notify once it's published
+	previous := blog.Content
+	if blog.Status == models.BlogDraft {
+		previous = ""
+	}
 	blog.Title = body.Title
 	blog.Content = body.Content
+	if body.Status != "" {
+		blog.Status = body.Status
+	}
 	config.DB.Save(&blog)
+	if blog.Status == models.BlogPublished {
+		notifyMentions(blog.Content, previous, c.MustGet("userID").(uint), &blog, nil, 0)
+	}
 	c.JSON(http.StatusOK, gin.H{"blog": blog})
 }
 
 func DeleteBlog(c *gin.Context) {
 	id := c.Param("id")
-	uid := c.MustGet("userID").(uint)
 	var blog models.Blog
 	if err := config.DB.First(&blog, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error":"not found"})
 		return
 	}
-	if blog.AuthorID != uid {
+	uid := c.MustGet("userID").(uint)
+	detail := fmt.Sprintf("%q by user %d", blog.Title, blog.AuthorID)
+	if !canModify(c, blog, utils.PermBlogsDeleteOwn, utils.PermBlogsDeleteAny) {
+		audit(c, "blog.delete", uid, auditTarget("blog", blog.ID), auditFailure, detail)
 		c.JSON(http.StatusForbidden, gin.H{"error":"not owner"})
 		return
 	}
 	config.DB.Delete(&blog)
+	audit(c, "blog.delete", uid, auditTarget("blog", blog.ID), auditSuccess, detail)
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
@@ -23,20 +23,32 @@ func AddComment(c *gin.Context) {
 	}
 	uid := c.MustGet("userID").(uint)
 	var blog models.Blog
-	if err := config.DB.First(&blog, c.Param("id")).Error; err != nil {
+	if err := config.DB.Scopes(visibleBlogs(c)).First(&blog, c.Param("id")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error":"blog not found"}); return
 	}
+	if isBlocked(blog.AuthorID, uid) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't comment on this post"})
+		return
+	}
 	comment := models.Comment{Content: body.Content, UserID: uid, BlogID: blog.ID}
 	if err := config.DB.Create(&comment).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error":"failed"}); return
 	}
-	config.DB.Preload("User").First(&comment, comment.ID)
+	notifyUser(blog.AuthorID, models.NotifyComment, uid, &blog, &comment.ID)
+	notifyMentions(comment.Content, "", uid, &blog, &comment.ID, blog.AuthorID)
+	config.DB.Preload("User", withDeleted).First(&comment, comment.ID)
 	c.JSON(http.StatusCreated, gin.H{"comment": comment})
 }
 
 func GetComments(c *gin.Context) {
+	var blog models.Blog
+	if err := config.DB.Scopes(visibleBlogs(c)).First(&blog, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "blog not found"})
+		return
+	}
 	var comments []models.Comment
-	config.DB.Preload("User").Where("blog_id = ?", c.Param("id")).Order("created_at asc").Find(&comments)
+	q := withoutMuted(c, config.DB.Where("blog_id = ?", blog.ID), "user_id")
+	q.Preload("User", withDeleted).Order("created_at asc").Find(&comments)
 	c.JSON(http.StatusOK, gin.H{"data": comments})
 }
 
@@ -48,7 +60,7 @@ func ToggleLike(c *gin.Context) {
 	var blog models.Blog
 
 	// ✅ Blog fetch karo
-	if err := config.DB.First(&blog, blogID).Error; err != nil {
+	if err := config.DB.Scopes(visibleBlogs(c)).First(&blog, blogID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Blog not found"})
 		return
 	}
@@ -92,7 +104,11 @@ func ToggleLike(c *gin.Context) {
 		return
 	}
 
-	// ✅ If like doesn't exist → LIKE
+	// ✅ If like doesn't exist → LIKE (blocked users can still take theirs back)
+	if isBlocked(blog.AuthorID, uid) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't like this post"})
+		return
+	}
 	like := models.Like{
 		UserID: uid,
 		BlogID: blog.ID,
@@ -102,6 +118,7 @@ func ToggleLike(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to like"})
 		return
 	}
+	notifyUser(blog.AuthorID, models.NotifyLike, uid, &blog, nil)
 
 	// ✅ Add user ID to liked_by array
 	blog.LikedBy = append(blog.LikedBy, int64(uid))
@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errBadCursor = errors.New("invalid cursor")
+
+// Keyset pagination cursors point just past the last row of a page that is
+// ordered by (created_at desc, id desc). They are opaque to clients.
+func encodeCursor(t time.Time, id uint) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d:%d", t.UnixMicro(), id))
+}
+
+func decodeCursor(s string) (time.Time, uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, 0, errBadCursor
+	}
+	var micros int64
+	var id uint
+	if _, err := fmt.Sscanf(string(raw), "%d:%d", &micros, &id); err != nil {
+		return time.Time{}, 0, errBadCursor
+	}
+	return time.UnixMicro(micros), id, nil
+}
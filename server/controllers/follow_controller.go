@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// followCounts returns how many users follow id and how many it follows.
+func followCounts(id uint) (followers, following int64) {
+	config.DB.Model(&models.Follow{}).Where("followee_id = ?", id).Count(&followers)
+	config.DB.Model(&models.Follow{}).Where("follower_id = ?", id).Count(&following)
+	return followers, following
+}
+
+// likeCounts returns the number of likes of each of the given blogs.
+func likeCounts(blogs []models.Blog) map[uint]int64 {
+	counts := map[uint]int64{}
+	if len(blogs) == 0 {
+		return counts
+	}
+	ids := make([]uint, len(blogs))
+	for i, b := range blogs {
+		ids[i] = b.ID
+	}
+	var rows []struct {
+		BlogID uint
+		Count  int64
+	}
+	config.DB.Model(&models.Like{}).Select("blog_id, count(*) as count").Where("blog_id IN ?", ids).Group("blog_id").Scan(&rows)
+	for _, r := range rows {
+		counts[r.BlogID] = r.Count
+	}
+	return counts
+}
+
+// ===============================
+// Follow Controllers
+// ===============================
+
+// FollowUser is idempotent: following someone twice is not an error.
+func FollowUser(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	user, err := findUserByRef(c.Param("ref"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.ID == uid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't follow yourself"})
+		return
+	}
+	if isBlocked(user.ID, uid) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't follow this user"})
+		return
+	}
+
+	follow := models.Follow{FollowerID: uid, FolloweeID: user.ID}
+	res := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&follow)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to follow user"})
+		return
+	}
+	if res.RowsAffected > 0 {
+		notifyUser(user.ID, models.NotifyFollow, uid, nil, nil)
+	}
+	followers, _ := followCounts(user.ID)
+	c.JSON(http.StatusOK, gin.H{"following": true, "followers": followers})
+}
+
+func UnfollowUser(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	user, err := findUserByRef(c.Param("ref"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := config.DB.Where("follower_id = ? AND followee_id = ?", uid, user.ID).Delete(&models.Follow{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unfollow user"})
+		return
+	}
+	followers, _ := followCounts(user.ID)
+	c.JSON(http.StatusOK, gin.H{"following": false, "followers": followers})
+}
+
+type followEntry struct {
+	User       models.PublicUser `json:"user"`
+	FollowedAt time.Time         `json:"followed_at"`
+}
+
+// listFollows pages through the follows where column is the user of the
+// URL, most recent first, and returns the users on the other side.
+func listFollows(c *gin.Context, column, other string) {
+	user, err := findUserByRef(c.Param("ref"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	page, limit, offset := pagination(c)
+
+	q := config.DB.Model(&models.Follow{}).Where(column+" = ?", user.ID)
+	var total int64
+	var follows []models.Follow
+	q.Count(&total)
+	q.Preload(other).Order("created_at desc, id desc").Limit(limit).Offset(offset).Find(&follows)
+
+	data := make([]followEntry, len(follows))
+	for i, f := range follows {
+		u := f.Follower
+		if other == "Followee" {
+			u = f.Followee
+		}
+		data[i] = followEntry{User: u.Public(), FollowedAt: f.CreatedAt}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  data,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+func GetFollowers(c *gin.Context) {
+	listFollows(c, "followee_id", "Follower")
+}
+
+func GetFollowing(c *gin.Context) {
+	listFollows(c, "follower_id", "Followee")
+}
+
+// ===============================
+// Feed Controller
+// ===============================
+
+// GetFeed returns posts by the authors the user follows, newest first.
+// Unlike GET /blogs it pages with a cursor instead of an offset, so deep
+// pages cost the same as the first and new posts don't shift the pages.
+func GetFeed(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	_, limit, _ := pagination(c)
+
+	followed := config.DB.Model(&models.Follow{}).Select("followee_id").Where("follower_id = ?", uid)
+	q := config.DB.Scopes(published).Preload("Author", withDeleted).Where("author_id IN (?) AND author_id NOT IN (?)", followed, mutedBy(uid))
+	if cursor := c.Query("cursor"); cursor != "" {
+		t, id, err := decodeCursor(cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		q = q.Where("(created_at, id) < (?, ?)", t, id)
+	}
+
+	// One extra row tells whether there is a next page
+	var blogs []models.Blog
+	if err := q.Order("created_at desc, id desc").Limit(limit + 1).Find(&blogs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load feed"})
+		return
+	}
+	var next *string
+	if len(blogs) > limit {
+		blogs = blogs[:limit]
+		last := blogs[limit-1]
+		cursor := encodeCursor(last.CreatedAt, last.ID)
+		next = &cursor
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        blogs,
+		"limit":       limit,
+		"next_cursor": next,
+		"likes":       likeCounts(blogs),
+	})
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+	"blogapp/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// admissionError is why a new account (or a new email address) is refused,
+// reported against one field of the form.
+type admissionError struct {
+	field, msg string
+}
+
+func (e *admissionError) Error() string { return e.field + " " + e.msg }
+
+// emailAllowed applies the disposable domain list and, in "domain" mode,
+// the domain allowlist. Invited users may use any other domain.
+func emailAllowed(email string, invited bool) error {
+	if utils.IsDisposableEmail(email) {
+		return &admissionError{"email", "is from a disposable email provider"}
+	}
+	if config.C.RegistrationMode == "domain" && !invited &&
+		!utils.DomainMatches(utils.EmailDomain(email), config.C.RegistrationDomains) {
+		return &admissionError{"email", "must be an address at " + strings.Join(config.C.RegistrationDomains, ", ")}
+	}
+	return nil
+}
+
+// admitNewUser decides whether an account may be created for email under
+// REGISTRATION_MODE. A valid invite code lets anyone with a non-disposable
+// address in and uses up one use of the invite, so it must run in the
+// transaction that creates the user. The invite's id is returned.
+func admitNewUser(tx *gorm.DB, email, inviteCode string) (*uint, error) {
+	if inviteCode == "" {
+		if config.C.RegistrationMode == "invite" {
+			return nil, &admissionError{"invite_code", "is required"}
+		}
+		return nil, emailAllowed(email, false)
+	}
+
+	if err := emailAllowed(email, true); err != nil {
+		return nil, err
+	}
+	var invite models.Invite
+	res := tx.Model(&invite).Clauses(clause.Returning{}).
+		Where("code_hash = ? AND revoked_at IS NULL AND uses < max_uses", utils.HashToken(strings.TrimSpace(inviteCode))).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Update("uses", gorm.Expr("uses + 1"))
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, &admissionError{"invite_code", "is invalid or expired"}
+	}
+	return &invite.ID, nil
+}
+
+// admissionFailed answers the request when err refused an account.
+func admissionFailed(c *gin.Context, err error) bool {
+	var ae *admissionError
+	if !errors.As(err, &ae) {
+		return false
+	}
+	fieldErrors(c, map[string][]string{ae.field: {ae.msg}})
+	return true
+}
+
+// ===============================
+// Admin: Invites
+// ===============================
+func AdminListInvites(c *gin.Context) {
+	page, limit, offset := pagination(c)
+
+	q := config.DB.Model(&models.Invite{})
+	switch c.Query("status") {
+	case "active":
+		q = q.Where("revoked_at IS NULL AND uses < max_uses").
+			Where("expires_at IS NULL OR expires_at > ?", time.Now())
+	case "revoked":
+		q = q.Where("revoked_at IS NOT NULL")
+	}
+
+	var total int64
+	var invites []models.Invite
+	q.Count(&total)
+	q.Order("created_at desc").Limit(limit).Offset(offset).Find(&invites)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  invites,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// AdminCreateInvite creates an invite code. Like a personal access token,
+// the code is only ever shown in this response.
+func AdminCreateInvite(c *gin.Context) {
+	type InviteDTO struct {
+		Note          string `json:"note" binding:"max=200"`
+		MaxUses       int    `json:"max_uses" binding:"omitempty,min=1,max=10000"`
+		ExpiresInDays int    `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+	}
+
+	var body InviteDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.MaxUses == 0 {
+		body.MaxUses = 1
+	}
+
+	code, err := utils.GenerateToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invite"})
+		return
+	}
+
+	uid := c.MustGet("userID").(uint)
+	invite := models.Invite{
+		CreatedByID: &uid,
+		Note:        body.Note,
+		Prefix:      code[:6],
+		CodeHash:    utils.HashToken(code),
+		MaxUses:     body.MaxUses,
+	}
+	if body.ExpiresInDays > 0 {
+		exp := time.Now().AddDate(0, 0, body.ExpiresInDays)
+		invite.ExpiresAt = &exp
+	}
+	if err := config.DB.Create(&invite).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invite"})
+		return
+	}
+	audit(c, "invite.create", uid, auditTarget("invite", invite.ID), auditSuccess, invite.Note)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Share the code now, it won't be shown again",
+		"code":    code,
+		"data":    invite,
+	})
+}
+
+// AdminRevokeInvite stops an invite from being used. Users who already
+// registered with it keep their invite_id.
+func AdminRevokeInvite(c *gin.Context) {
+	res := config.DB.Model(&models.Invite{}).
+		Where("id = ? AND revoked_at IS NULL", c.Param("id")).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke invite"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invite not found"})
+		return
+	}
+	audit(c, "invite.revoke", c.MustGet("userID").(uint), "invite:"+c.Param("id"), auditSuccess, "")
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
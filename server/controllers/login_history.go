@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+	"blogapp/notify"
+	"blogapp/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How long the "this wasn't me" link of a login alert works
+const loginAlertTTL = 7 * 24 * time.Hour
+
+// recordLogin adds an entry to the user's login history.
+func recordLogin(c *gin.Context, userID uint, sessionID *uint, method string, success bool, reason string, newDevice bool) {
+	ua := c.Request.UserAgent()
+	ev := models.LoginEvent{
+		UserID:      userID,
+		SessionID:   sessionID,
+		Method:      method,
+		Success:     success,
+		Reason:      reason,
+		IP:          c.ClientIP(),
+		Network:     utils.IPNetwork(c.ClientIP()),
+		UserAgent:   ua,
+		DeviceLabel: utils.DeviceLabel(ua),
+		NewDevice:   newDevice,
+	}
+	if err := config.DB.Create(&ev).Error; err != nil {
+		log.Println("login history write failed:", err)
+	}
+}
+
+// loginFailed records a failed login of a known account in the audit log
+// and the user's login history.
+func loginFailed(c *gin.Context, userID uint, method, reason string) {
+	audit(c, "auth.login", userID, auditTarget("user", userID), auditFailure, method+": "+reason)
+	recordLogin(c, userID, nil, method, false, reason, false)
+}
+
+// loginSucceeded records a new session in the login history. If the user
+// has logged in before but never with this device or from this network,
+// they are emailed an alert with a link to end the session.
+func loginSucceeded(c *gin.Context, user models.User, session models.Session, method string) {
+	var seen struct {
+		Logins, Device, Network int64
+	}
+	config.DB.Model(&models.LoginEvent{}).
+		Select("COUNT(*) AS logins, COUNT(*) FILTER (WHERE device_label = ?) AS device, COUNT(*) FILTER (WHERE network = ?) AS network",
+			session.DeviceLabel, utils.IPNetwork(session.IP)).
+		Where("user_id = ? AND success", user.ID).
+		Scan(&seen)
+	newDevice := seen.Logins > 0 && (seen.Device == 0 || seen.Network == 0)
+
+	recordLogin(c, user.ID, &session.ID, method, true, "", newDevice)
+	if newDevice {
+		go sendLoginAlert(user, session, method)
+	}
+}
+
+func sendLoginAlert(user models.User, session models.Session, method string) {
+	token, err := utils.GenerateLoginAlertToken(config.Keys, user.ID, session.ID, loginAlertTTL)
+	if err != nil {
+		log.Println("login alert failed:", err)
+		return
+	}
+	link, err := url.Parse(config.C.LoginAlertURL)
+	if err != nil {
+		log.Println("login alert failed:", err)
+		return
+	}
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+
+	err = notify.SendTemplate(context.Background(), notify.Email, user.Email, "login_alert", gin.H{
+		"Name":      user.FirstName,
+		"Time":      session.CreatedAt.UTC().Format("January 2, 2006 15:04 MST"),
+		"Device":    session.DeviceLabel,
+		"IP":        session.IP,
+		"Method":    method,
+		"URL":       link.String(),
+		"ExpiresIn": int(loginAlertTTL.Hours() / 24),
+	})
+	if err != nil {
+		log.Println("login alert failed:", err)
+	}
+}
+
+// ===============================
+// Login Alert Controller
+// ===============================
+
+// DenyLogin handles the "this wasn't me" link of a login alert. It ends all
+// of the user's sessions, since the intruder may have refreshed or opened
+// others, blocks password logins until the password is reset and emails a
+// reset code straight away.
+func DenyLogin(c *gin.Context) {
+	type DenyDTO struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	var body DenyDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid, sid, err := utils.ParseLoginAlertToken(config.Keys, body.Token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	// The link works once. Claiming the session keeps a replay, e.g. after
+	// the password was reset, from logging everyone out and locking the
+	// account again.
+	res := config.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND denied_at IS NULL", sid, user.ID).
+		Update("denied_at", time.Now())
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end the sessions"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "This link has already been used"})
+		return
+	}
+
+	if err := revokeSessions("user_id = ?", user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end the sessions"})
+		return
+	}
+	if err := config.DB.Model(&user).Update("password_reset_required", true).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock the account"})
+		return
+	}
+	audit(c, "auth.login_denied", user.ID, auditTarget("session", sid), auditSuccess, "reported from a login alert")
+
+	// A cooldown means a code went out moments ago, which is just as good,
+	// and a locked one can be requested again once it expires
+	otp, err := issueOTP(user.ID, models.OTPResetPassword, "")
+	if err == nil {
+		err = sendOTP(c, user, notify.Email, otp, models.OTPResetPassword)
+	}
+	if err != nil && err != errOTPCooldown && err != errOTPLocked {
+		log.Println("OTP delivery failed:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "All sessions have been logged out. We've emailed you a code to reset your password.",
+	})
+}
+
+// ===============================
+// Login History Controller
+// ===============================
+func GetMyLogins(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	page, limit, offset := pagination(c)
+
+	q := config.DB.Model(&models.LoginEvent{}).Where("user_id = ?", uid)
+	switch c.Query("status") {
+	case "success":
+		q = q.Where("success")
+	case "failure":
+		q = q.Where("NOT success")
+	}
+
+	var total int64
+	var logins []models.LoginEvent
+	q.Count(&total)
+	q.Order("created_at desc, id desc").Limit(limit).Offset(offset).Find(&logins)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  logins,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+
+	"blogapp/config"
+	"blogapp/models"
+	"blogapp/notify"
+	"blogapp/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const msgMagicLinkSent = "If the account exists, a login link has been sent"
+
+// ===============================
+// Request Magic Link Controller
+// ===============================
+
+// RequestMagicLink emails a login link to the account's address. The link
+// carries a signed token whose jti is stored like an OTP, so it is single-use
+// and a newer link replaces an older one.
+func RequestMagicLink(c *gin.Context) {
+	type MagicLinkDTO struct {
+		EmailOrPhone string `json:"email_or_phone" binding:"required"`
+	}
+
+	var body MagicLinkDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := findByIdentifier(body.EmailOrPhone)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": msgMagicLinkSent})
+		return
+	}
+
+	nonce, err := issueOTP(user.ID, models.OTPMagicLink, "")
+	if err == errOTPCooldown || err == errOTPLocked {
+		c.JSON(http.StatusOK, gin.H{"message": msgMagicLinkSent})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link"})
+		return
+	}
+
+	token, err := utils.GenerateMagicLinkToken(config.Keys, user.ID, nonce, otpTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link"})
+		return
+	}
+
+	link, err := url.Parse(config.C.MagicLinkURL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link"})
+		return
+	}
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+
+	// Sent in the background so the response time doesn't give away
+	// whether the account exists.
+	go func() {
+		err := notify.SendTemplate(context.Background(), notify.Email, user.Email, "magic_link", gin.H{
+			"Name":      user.FirstName,
+			"URL":       link.String(),
+			"ExpiresIn": int(otpTTL.Minutes()),
+		})
+		if err != nil {
+			log.Println("magic link delivery failed:", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, gin.H{"message": msgMagicLinkSent})
+}
+
+// ===============================
+// Consume Magic Link Controller
+// ===============================
+
+// ConsumeMagicLink exchanges a login link token for the same response as
+// Login. The link went to the account's email, so using it also verifies
+// the address.
+func ConsumeMagicLink(c *gin.Context) {
+	type ConsumeDTO struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	var body ConsumeDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid, nonce, err := utils.ParseMagicLinkToken(config.Keys, body.Token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login link"})
+		return
+	}
+	if _, err := checkOTP(uid, models.OTPMagicLink, nonce); err != nil {
+		loginFailed(c, uid, "magic_link", err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login link"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login link"})
+		return
+	}
+	if !user.IsOTPVerified {
+		config.DB.Model(&user).Update("is_otp_verified", true)
+	}
+
+	res, err := loginResponse(c, user, "magic_link")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+	"blogapp/notify"
+	"blogapp/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Mentions beyond this many in one post or comment are ignored
+const maxMentions = 10
+
+// How many of a grouped notification's actors are listed by name
+const listedActors = 3
+
+type notifyChannels struct {
+	InApp bool `json:"in_app"`
+	Email bool `json:"email"`
+}
+
+// Delivery of each notification type for users who haven't changed it
+var defaultNotifyChannels = map[string]notifyChannels{
+	models.NotifyLike:    {InApp: true},
+	models.NotifyComment: {InApp: true, Email: true},
+	models.NotifyFollow:  {InApp: true},
+	models.NotifyMention: {InApp: true, Email: true},
+}
+
+// notificationPrefs returns how uid wants each notification type delivered.
+func notificationPrefs(uid uint) map[string]notifyChannels {
+	prefs := maps.Clone(defaultNotifyChannels)
+	var rows []models.NotificationPreference
+	config.DB.Where("user_id = ?", uid).Find(&rows)
+	for _, p := range rows {
+		prefs[p.Type] = notifyChannels{InApp: p.InApp, Email: p.Email}
+	}
+	return prefs
+}
+
+// notifyUser tells recipient that actorID liked, commented on or mentioned
+// them in blog, or followed them (blog is nil), in-app and/or by email as
+// they chose. Nothing is sent for users the recipient blocked or muted.
+// Failures are only logged; they never fail the action itself.
+func notifyUser(recipient uint, kind string, actorID uint, blog *models.Blog, commentID *uint) {
+	if recipient == actorID || isBlocked(recipient, actorID) || isMuted(recipient, actorID) {
+		return
+	}
+	prefs := notificationPrefs(recipient)[kind]
+
+	if prefs.InApp {
+		n := models.Notification{
+			UserID:    recipient,
+			GroupKey:  kind,
+			Type:      kind,
+			CommentID: commentID,
+			ActorIDs:  pq.Int64Array{int64(actorID)},
+		}
+		if blog != nil {
+			n.BlogID = &blog.ID
+			n.GroupKey = fmt.Sprintf("%s:%d", kind, blog.ID)
+		}
+		// Join the unread notification of the same group if there is one,
+		// moving the actor to the front
+		err := config.DB.Clauses(clause.OnConflict{
+			Columns:     []clause.Column{{Name: "user_id"}, {Name: "group_key"}},
+			TargetWhere: clause.Where{Exprs: []clause.Expression{gorm.Expr("read_at IS NULL")}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"actor_ids":  gorm.Expr("excluded.actor_ids || array_remove(notifications.actor_ids, excluded.actor_ids[1])"),
+				"comment_id": gorm.Expr("COALESCE(excluded.comment_id, notifications.comment_id)"),
+				"updated_at": gorm.Expr("excluded.updated_at"),
+			}),
+		}).Create(&n).Error
+		if err != nil {
+			log.Println("notification write failed:", err)
+		}
+	}
+	if prefs.Email {
+		go emailNotification(recipient, kind, actorID, blog)
+	}
+}
+
+// notifyMentions notifies the users mentioned in text but not already in
+// previous (the text before an edit). skip is someone the same event
+// already notifies, e.g. the author of a commented post.
+func notifyMentions(text, previous string, actorID uint, blog *models.Blog, commentID *uint, skip uint) {
+	handles := utils.Mentions(text, maxMentions)
+	old := utils.Mentions(previous, maxMentions)
+	handles = slices.DeleteFunc(handles, func(h string) bool { return slices.Contains(old, h) })
+	if len(handles) == 0 {
+		return
+	}
+
+	var users []models.User
+	config.DB.Where("LOWER(handle) IN ? AND handle <> ''", handles).Find(&users)
+	for _, u := range users {
+		if u.ID != skip {
+			notifyUser(u.ID, models.NotifyMention, actorID, blog, commentID)
+		}
+	}
+}
+
+func emailNotification(recipient uint, kind string, actorID uint, blog *models.Blog) {
+	var user, actor models.User
+	if config.DB.First(&user, recipient).Error != nil || !user.IsOTPVerified {
+		return
+	}
+	config.DB.Unscoped().First(&actor, actorID)
+	title := ""
+	if blog != nil {
+		title = blog.Title
+	}
+
+	err := notify.SendTemplate(context.Background(), notify.Email, user.Email, "notification", gin.H{
+		"Name":    user.FirstName,
+		"Message": notificationMessage(kind, []string{displayName(actor)}, 1, title),
+		"URL":     config.C.NotificationsURL,
+	})
+	if err != nil {
+		log.Println("notification email failed:", err)
+	}
+}
+
+func displayName(u models.User) string {
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
+
+// notificationMessage describes a notification, e.g. `Ann and 4 others
+// liked your post "Hello"`.
+func notificationMessage(kind string, names []string, count int, title string) string {
+	who := "Someone"
+	if len(names) > 0 {
+		who = names[0]
+	}
+	switch {
+	case count == 2 && len(names) > 1:
+		who += " and " + names[1]
+	case count == 2:
+		who += " and 1 other"
+	case count > 2:
+		who += fmt.Sprintf(" and %d others", count-1)
+	}
+
+	switch kind {
+	case models.NotifyLike:
+		return fmt.Sprintf("%s liked your post %q", who, title)
+	case models.NotifyComment:
+		return fmt.Sprintf("%s commented on your post %q", who, title)
+	case models.NotifyFollow:
+		return who + " followed you"
+	case models.NotifyMention:
+		return fmt.Sprintf("%s mentioned you on %q", who, title)
+	}
+	return who
+}
+
+type notificationView struct {
+	models.Notification
+	Count   int                 `json:"count"`
+	Actors  []models.PublicUser `json:"actors"` // the most recent ones
+	Read    bool                `json:"read"`
+	Message string              `json:"message"`
+}
+
+// notificationViews adds the actors and a message to notifications.
+func notificationViews(notifications []models.Notification) []notificationView {
+	var ids []int64
+	for _, n := range notifications {
+		ids = append(ids, n.ActorIDs[:min(len(n.ActorIDs), listedActors)]...)
+	}
+	var users []models.User
+	if len(ids) > 0 {
+		config.DB.Unscoped().Where("id IN ?", ids).Find(&users)
+	}
+	byID := map[int64]models.User{}
+	for _, u := range users {
+		byID[int64(u.ID)] = u
+	}
+
+	views := make([]notificationView, len(notifications))
+	for i, n := range notifications {
+		v := notificationView{Notification: n, Count: len(n.ActorIDs), Actors: []models.PublicUser{}, Read: n.ReadAt != nil}
+		var names []string
+		for _, id := range n.ActorIDs[:min(len(n.ActorIDs), listedActors)] {
+			if u, ok := byID[id]; ok {
+				v.Actors = append(v.Actors, u.Public())
+				names = append(names, displayName(u))
+			}
+		}
+		title := ""
+		if n.Blog != nil {
+			title = n.Blog.Title
+		}
+		v.Message = notificationMessage(n.Type, names, v.Count, title)
+		views[i] = v
+	}
+	return views
+}
+
+func unreadNotifications(uid uint) int64 {
+	var unread int64
+	config.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", uid).Count(&unread)
+	return unread
+}
+
+// ===============================
+// Notification Controllers
+// ===============================
+
+// GetNotifications lists the user's notifications, most recently updated
+// first.
+func GetNotifications(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	page, limit, offset := pagination(c)
+
+	q := config.DB.Model(&models.Notification{}).Where("user_id = ?", uid)
+	switch c.Query("status") {
+	case "unread":
+		q = q.Where("read_at IS NULL")
+	case "read":
+		q = q.Where("read_at IS NOT NULL")
+	}
+
+	var total int64
+	var notifications []models.Notification
+	q.Count(&total)
+	q.Preload("Blog", withDeleted).Order("updated_at desc, id desc").Limit(limit).Offset(offset).Find(&notifications)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   notificationViews(notifications),
+		"page":   page,
+		"limit":  limit,
+		"total":  total,
+		"unread": unreadNotifications(uid),
+	})
+}
+
+func GetUnreadNotificationCount(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"unread": unreadNotifications(c.MustGet("userID").(uint))})
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	var n models.Notification
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), uid).First(&n).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	if n.ReadAt == nil {
+		if err := config.DB.Model(&n).Update("read_at", time.Now()).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "unread": unreadNotifications(uid)})
+}
+
+func MarkAllNotificationsRead(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	res := config.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", uid).
+		Update("read_at", time.Now())
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"updated": res.RowsAffected, "unread": 0})
+}
+
+// ===============================
+// Notification Preferences
+// ===============================
+func GetNotificationPreferences(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": notificationPrefs(c.MustGet("userID").(uint))})
+}
+
+// UpdateNotificationPreferences takes {"<type>": {"in_app", "email"}} for
+// any of the types; omitted types and fields are left as they are.
+func UpdateNotificationPreferences(c *gin.Context) {
+	type channelsDTO struct {
+		InApp *bool `json:"in_app"`
+		Email *bool `json:"email"`
+	}
+
+	var body map[string]channelsDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	errs := map[string][]string{}
+	for kind := range body {
+		if !slices.Contains(models.NotificationTypes, kind) {
+			errs[kind] = []string{"is not a notification type (" + strings.Join(models.NotificationTypes, ", ") + ")"}
+		}
+	}
+	if len(errs) > 0 {
+		fieldErrors(c, errs)
+		return
+	}
+
+	uid := c.MustGet("userID").(uint)
+	prefs := notificationPrefs(uid)
+	rows := make([]models.NotificationPreference, 0, len(body))
+	for kind, ch := range body {
+		p := prefs[kind]
+		if ch.InApp != nil {
+			p.InApp = *ch.InApp
+		}
+		if ch.Email != nil {
+			p.Email = *ch.Email
+		}
+		prefs[kind] = p
+		rows = append(rows, models.NotificationPreference{UserID: uid, Type: kind, InApp: p.InApp, Email: p.Email})
+	}
+	if len(rows) > 0 {
+		err := config.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "type"}},
+			DoUpdates: clause.AssignmentColumns([]string{"in_app", "email"}),
+		}).Create(&rows).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save preferences"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": prefs})
+}
@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+	"blogapp/oidc"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+// ===============================
+// OIDC Login Controller
+// ===============================
+// OIDCLogin sends the user to the provider's authorization endpoint. With
+// ?redirect=false the URL is returned as JSON instead, for SPAs that want
+// to navigate themselves. ?invite= carries an invite code for when the
+// login ends up creating an account.
+func OIDCLogin(c *gin.Context) {
+	p, ok := oidc.Providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown provider"})
+		return
+	}
+
+	state, err1 := oidc.RandomString()
+	nonce, err2 := oidc.RandomString()
+	verifier, err3 := oidc.RandomString()
+	if err := errors.Join(err1, err2, err3); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	authURL, err := p.AuthCodeURL(c.Request.Context(), state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		log.Println("oidc:", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "provider unavailable"})
+		return
+	}
+
+	// Abandoned logins are cleaned up here rather than by a separate job
+	config.DB.Where("expires_at < ?", time.Now()).Delete(&models.OIDCState{})
+
+	if err := config.DB.Create(&models.OIDCState{
+		State:        state,
+		Provider:     p.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		InviteCode:   c.Query("invite"),
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	if c.Query("redirect") == "false" {
+		c.JSON(http.StatusOK, gin.H{"auth_url": authURL})
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// ===============================
+// OIDC Callback Controller
+// ===============================
+func OIDCCallback(c *gin.Context) {
+	p, ok := oidc.Providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown provider"})
+		return
+	}
+
+	if e := c.Query("error"); e != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login cancelled: " + e})
+		return
+	}
+
+	// The state row is deleted as it is read so a callback URL can't be
+	// replayed.
+	var st models.OIDCState
+	res := config.DB.Clauses(clause.Returning{}).
+		Where("state = ? AND provider = ?", c.Query("state"), p.Name).
+		Delete(&st)
+	if res.Error != nil || res.RowsAffected == 0 || time.Now().After(st.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired login request"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	rawIDToken, err := p.Exchange(ctx, c.Query("code"), st.CodeVerifier)
+	if err != nil {
+		log.Println("oidc:", err)
+		audit(c, "auth.login", 0, "", auditFailure, "oidc:"+p.Name+": "+err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login failed"})
+		return
+	}
+	claims, err := p.Verify(ctx, rawIDToken, st.Nonce)
+	if err != nil {
+		log.Println("oidc:", err)
+		audit(c, "auth.login", 0, "", auditFailure, "oidc:"+p.Name+": "+err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login failed"})
+		return
+	}
+
+	user, err := userForIdentity(p.Name, claims, st.InviteCode)
+	if err != nil {
+		var ae *admissionError
+		if errors.As(err, &ae) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "registration not allowed: " + ae.Error()})
+			return
+		}
+		if errors.Is(err, errNoVerifiedEmail) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Println("oidc:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+
+	tokens, err := loginResponse(c, user, "oidc:"+p.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	if config.C.OIDCSuccessRedirect != "" {
+		// Tokens go in the fragment so they never reach the frontend's
+		// server logs. Every field is kept, e.g. two_factor_methods of a
+		// 2FA challenge.
+		frag := url.Values{}
+		for k, v := range tokens {
+			frag.Set(k, fragmentValue(v))
+		}
+		c.Redirect(http.StatusFound, config.C.OIDCSuccessRedirect+"#"+frag.Encode())
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// fragmentValue flattens a login response field for the redirect fragment:
+// lists are comma-separated, anything else is printed as is.
+func fragmentValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+var errNoVerifiedEmail = errors.New("the provider did not return a verified email address")
+
+// userForIdentity finds the user an external identity belongs to. Unknown
+// identities are linked to the local account with the same verified email,
+// or get a new account when there is none and REGISTRATION_MODE lets them
+// in.
+func userForIdentity(provider string, claims *oidc.Claims, inviteCode string) (models.User, error) {
+	var user models.User
+
+	var identity models.UserIdentity
+	err := config.DB.Preload("User").
+		Where("provider = ? AND subject = ?", provider, claims.Subject).
+		First(&identity).Error
+	if err == nil {
+		return identity.User, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return user, errNoVerifiedEmail
+	}
+	email := strings.ToLower(claims.Email)
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("LOWER(email) = ?", email).First(&user).Error
+		switch {
+		case err == nil:
+			// Someone could have registered this address without being able
+			// to verify it. The provider has now proven who owns it, so any
+			// password set by the unverified registration is dropped.
+			if !user.IsOTPVerified {
+				if err := tx.Model(&user).Updates(map[string]interface{}{
+					"is_otp_verified": true,
+					"password":        "",
+				}).Error; err != nil {
+					return err
+				}
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			first, last := claims.GivenName, claims.FamilyName
+			if first == "" && last == "" {
+				first, last, _ = strings.Cut(claims.Name, " ")
+			}
+			inviteID, err := admitNewUser(tx, email, inviteCode)
+			if err != nil {
+				return err
+			}
+			user = models.User{
+				FirstName:     first,
+				LastName:      last,
+				Email:         email,
+				IsOTPVerified: true,
+				InviteID:      inviteID,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: provider,
+			Subject:  claims.Subject,
+			Email:    email,
+		}).Error
+	})
+	return user, err
+}
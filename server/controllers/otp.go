@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+	"blogapp/notify"
+	"blogapp/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	otpTTL            = 5 * time.Minute
+	otpMaxAttempts    = 5
+	otpResendCooldown = time.Minute
+)
+
+var (
+	errOTPInvalid  = errors.New("Invalid OTP")
+	errOTPExpired  = errors.New("OTP expired")
+	errOTPLocked   = errors.New("Too many attempts, please try again in a few minutes")
+	errOTPCooldown = errors.New("Please wait before requesting another OTP")
+)
+
+// replaceOTP decides whether a resend may replace the pending code and
+// whether the new code inherits its attempts. They keep counting until the
+// pending code expires, so asking for a new code doesn't buy more guesses,
+// and a locked code can't be replaced before then.
+func replaceOTP(pending models.OTPCode, now time.Time) (keepAttempts bool, err error) {
+	if now.Sub(pending.LastSentAt) < otpResendCooldown {
+		return false, errOTPCooldown
+	}
+	if now.After(pending.ExpiresAt) {
+		return false, nil
+	}
+	if pending.Attempts >= otpMaxAttempts {
+		return false, errOTPLocked
+	}
+	return true, nil
+}
+
+// issueOTP generates a new code for the user and purpose, replacing any
+// pending one as replaceOTP allows, and returns it in plaintext so it can
+// be delivered. Only its hash is stored. target is kept with the code for
+// flows that confirm a new value, such as an email change.
+func issueOTP(userID uint, purpose models.OTPPurpose, target string) (string, error) {
+	columns := []string{"target", "code_hash", "expires_at", "attempts", "last_sent_at", "updated_at"}
+	var existing models.OTPCode
+	err := config.DB.Where("user_id = ? AND purpose = ?", userID, purpose).First(&existing).Error
+	if err == nil {
+		keep, err := replaceOTP(existing, time.Now())
+		if err != nil {
+			return "", err
+		}
+		if keep {
+			// Left out of the update rather than copied, so guesses made
+			// meanwhile still count
+			columns = slices.DeleteFunc(columns, func(c string) bool { return c == "attempts" })
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+
+	code, err := utils.GenerateOTP()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	otp := models.OTPCode{
+		UserID:     userID,
+		Purpose:    purpose,
+		Target:     target,
+		CodeHash:   utils.HashOTP(config.C.OTPSecret, code),
+		ExpiresAt:  now.Add(otpTTL),
+		LastSentAt: now,
+	}
+	err = config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "purpose"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(&otp).Error
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// checkOTP verifies code against the pending code for the user and purpose
+// and returns the consumed code. Every check counts towards otpMaxAttempts.
+func checkOTP(userID uint, purpose models.OTPPurpose, code string) (models.OTPCode, error) {
+	var otp models.OTPCode
+	if err := config.DB.Where("user_id = ? AND purpose = ?", userID, purpose).First(&otp).Error; err != nil {
+		return otp, errOTPInvalid
+	}
+	if otp.Attempts >= otpMaxAttempts {
+		return otp, errOTPLocked
+	}
+	if time.Now().After(otp.ExpiresAt) {
+		return otp, errOTPExpired
+	}
+
+	// The attempt is claimed with a conditional update before the code is
+	// compared, so concurrent guesses can't get past otpMaxAttempts.
+	res := config.DB.Model(&models.OTPCode{}).
+		Where("id = ? AND attempts < ?", otp.ID, otpMaxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if res.Error != nil {
+		return otp, errOTPInvalid
+	}
+	if res.RowsAffected == 0 {
+		return otp, errOTPLocked
+	}
+
+	if !utils.CheckOTP(config.C.OTPSecret, code, otp.CodeHash) {
+		if otp.Attempts+1 >= otpMaxAttempts {
+			return otp, errOTPLocked
+		}
+		return otp, errOTPInvalid
+	}
+
+	// Deleting by primary key and checking RowsAffected makes the code
+	// single-use even if two requests race with the same value.
+	res = config.DB.Delete(&otp)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return otp, errOTPInvalid
+	}
+	return otp, nil
+}
+
+var otpPurposeLabels = map[models.OTPPurpose]string{
+	models.OTPVerifyEmail:   "email verification",
+	models.OTPVerifyPhone:   "phone verification",
+	models.OTPResetPassword: "password reset",
+	models.OTPLogin:         "login",
+	models.OTPChangeEmail:   "email change",
+	models.OTPChangePhone:   "phone number change",
+	models.OTPReauth:        "identity confirmation",
+}
+
+// sendOTP delivers an OTP to the user's email address or phone number.
+func sendOTP(c *gin.Context, user models.User, ch notify.Channel, otp string, purpose models.OTPPurpose) error {
+	to := user.Email
+	if ch == notify.SMS {
+		to = user.Phone
+	}
+	return sendOTPTo(c, user, ch, to, otp, purpose)
+}
+
+// sendOTPTo delivers an OTP to an address that isn't (yet) the user's.
+func sendOTPTo(c *gin.Context, user models.User, ch notify.Channel, to, otp string, purpose models.OTPPurpose) error {
+	return notify.SendTemplate(c.Request.Context(), ch, to, "otp", gin.H{
+		"Name":      user.FirstName,
+		"Code":      otp,
+		"Purpose":   otpPurposeLabels[purpose],
+		"ExpiresIn": int(otpTTL.Minutes()),
+	})
+}
+
+// otpError writes the response for an error returned by issueOTP or checkOTP.
+func otpError(c *gin.Context, err error) {
+	switch err {
+	case errOTPInvalid, errOTPExpired:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errOTPLocked, errOTPCooldown:
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process OTP"})
+	}
+}
+
+const msgOTPSent = "If the account exists, an OTP has been sent"
+
+// deliverOTP issues and sends a code and writes the response. Cooldowns and
+// locked codes are answered like a successful send, so the response never
+// depends on the account's state.
+func deliverOTP(c *gin.Context, user models.User, ch notify.Channel, purpose models.OTPPurpose) {
+	otp, err := issueOTP(user.ID, purpose, "")
+	if err == errOTPCooldown || err == errOTPLocked {
+		c.JSON(http.StatusOK, gin.H{"message": msgOTPSent})
+		return
+	}
+	if err != nil {
+		otpError(c, err)
+		return
+	}
+	if err := sendOTP(c, user, ch, otp, purpose); err != nil {
+		log.Println("OTP delivery failed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send OTP"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": msgOTPSent})
+}
+
+// findByIdentifier looks up the account for what the user typed into an
+// "email or phone" field.
+func findByIdentifier(identifier string) (models.User, error) {
+	var user models.User
+	err := config.DB.Where("email = ? OR phone = ?", identifier, identifier).First(&user).Error
+	return user, err
+}
+
+// checkOTPFor looks up the account for identifier and checks code for
+// purpose, charging failures to the brute-force counters. An unknown
+// account fails exactly like a wrong code. On failure the response has
+// already been written.
+func checkOTPFor(c *gin.Context, identifier string, purpose models.OTPPurpose, code string) (models.User, bool) {
+	var found *models.User
+	user, err := findByIdentifier(identifier)
+	if err == nil {
+		found = &user
+	}
+
+	keys := throttleKeys(c, identifier, found)
+	if checkLockout(c, keys) {
+		return user, false
+	}
+
+	err = errOTPInvalid
+	if found != nil {
+		_, err = checkOTP(user.ID, purpose, code)
+	}
+	if err != nil {
+		if err != errOTPExpired {
+			recordFailure(c, keys, found)
+		}
+		action := "auth.verify"
+		if purpose == models.OTPResetPassword {
+			action = "auth.password_reset"
+		}
+		if found != nil {
+			audit(c, action, user.ID, auditTarget("user", user.ID), auditFailure, err.Error())
+		} else {
+			audit(c, action, 0, "identifier:"+identifier, auditFailure, "unknown account")
+		}
+		otpError(c, err)
+		return user, false
+	}
+
+	clearFailures(keys)
+	return user, true
+}
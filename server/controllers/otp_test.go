@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"blogapp/models"
+)
+
+func TestReplaceOTP(t *testing.T) {
+	now := time.Now()
+	sent := func(ago time.Duration, attempts int) models.OTPCode {
+		return models.OTPCode{LastSentAt: now.Add(-ago), ExpiresAt: now.Add(otpTTL - ago), Attempts: attempts}
+	}
+
+	cases := []struct {
+		name    string
+		pending models.OTPCode
+		keep    bool
+		err     error
+	}{
+		{"within the cooldown", sent(30*time.Second, 0), false, errOTPCooldown},
+		{"pending, no guesses", sent(2*time.Minute, 0), true, nil},
+		{"pending, some guesses", sent(2*time.Minute, otpMaxAttempts-1), true, nil},
+		{"locked", sent(2*time.Minute, otpMaxAttempts), false, errOTPLocked},
+		{"expired", sent(otpTTL+time.Second, 2), false, nil},
+		{"expired after a lockout", sent(otpTTL+time.Second, otpMaxAttempts), false, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			keep, err := replaceOTP(tc.pending, now)
+			if keep != tc.keep || err != tc.err {
+				t.Fatalf("replaceOTP = %v, %v; want %v, %v", keep, err, tc.keep, tc.err)
+			}
+		})
+	}
+}
+
+// Resending every minute must not reset the attempt counter: the code stays
+// locked until the one that got locked expires.
+func TestResendAfterLockoutStaysLocked(t *testing.T) {
+	start := time.Now()
+	pending := models.OTPCode{LastSentAt: start, ExpiresAt: start.Add(otpTTL), Attempts: otpMaxAttempts}
+
+	for at := otpResendCooldown; at <= otpTTL; at += otpResendCooldown {
+		if _, err := replaceOTP(pending, start.Add(at)); err != errOTPLocked {
+			t.Fatalf("resend %v after the lockout: err = %v, want errOTPLocked", at, err)
+		}
+	}
+	keep, err := replaceOTP(pending, start.Add(otpTTL+time.Second))
+	if err != nil || keep {
+		t.Fatalf("resend after expiry = %v, %v; want a fresh code", keep, err)
+	}
+}
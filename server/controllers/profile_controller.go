@@ -0,0 +1,390 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"blogapp/config"
+	"blogapp/models"
+	"blogapp/notify"
+	"blogapp/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// ===============================
+// Update Profile Controller
+// ===============================
+type ProfileDTO struct {
+	FirstName   *string   `json:"first_name" binding:"omitempty,min=1,max=100"`
+	LastName    *string   `json:"last_name" binding:"omitempty,min=1,max=100"`
+	Bio         *string   `json:"bio" binding:"omitempty,max=2000"`
+	Handle      *string   `json:"handle"`
+	Website     *string   `json:"website" binding:"omitempty,max=200"`
+	Location    *string   `json:"location" binding:"omitempty,max=100"`
+	SocialLinks *[]string `json:"social_links" binding:"omitempty,max=5,dive,max=200"`
+}
+
+func UpdateMe(c *gin.Context) {
+	var body ProfileDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := c.MustGet("userID").(uint)
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if body.FirstName != nil {
+		updates["first_name"] = *body.FirstName
+	}
+	if body.LastName != nil {
+		updates["last_name"] = *body.LastName
+	}
+	if body.Bio != nil {
+		updates["bio"] = *body.Bio
+	}
+	if body.Location != nil {
+		updates["location"] = strings.TrimSpace(*body.Location)
+	}
+
+	problems := map[string][]string{}
+	if body.Handle != nil {
+		handle := utils.NormalizeHandle(*body.Handle)
+		if msg := utils.CheckHandle(handle); handle != "" && msg != "" {
+			problems["handle"] = append(problems["handle"], msg)
+		}
+		updates["handle"] = handle
+	}
+	if body.Website != nil {
+		if *body.Website != "" && !utils.IsWebURL(*body.Website) {
+			problems["website"] = append(problems["website"], "must be an http(s) URL")
+		}
+		updates["website"] = *body.Website
+	}
+	if body.SocialLinks != nil {
+		for _, link := range *body.SocialLinks {
+			if !utils.IsWebURL(link) {
+				problems["social_links"] = append(problems["social_links"], link+" is not an http(s) URL")
+			}
+		}
+		updates["social_links"] = pq.StringArray(*body.SocialLinks)
+	}
+	if len(problems) > 0 {
+		fieldErrors(c, problems)
+		return
+	}
+
+	if len(updates) > 0 {
+		err := config.DB.Model(&user).Updates(updates).Error
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			fieldErrors(c, map[string][]string{"handle": {"is already taken"}})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+			return
+		}
+	}
+
+	config.DB.First(&user, uid)
+	c.JSON(http.StatusOK, gin.H{"user": user.Self()})
+}
+
+// ===============================
+// Profile Image Controllers
+// ===============================
+const maxProfileImageSize = 5 << 20
+
+// setProfileImage uploads the "image" form file and stores its URL in
+// column, one of the user's profile picture columns.
+func setProfileImage(c *gin.Context, column string) {
+	file, header, err := c.Request.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image is required"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxProfileImageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image must be at most 5 MB"})
+		return
+	}
+	sniff := make([]byte, 512)
+	n, _ := io.ReadFull(file, sniff)
+	if !strings.HasPrefix(http.DetectContentType(sniff[:n]), "image/") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is not an image"})
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read image"})
+		return
+	}
+
+	url, err := utils.UploadImage(file, header)
+	if err != nil {
+		log.Println("profile image upload failed:", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to upload image"})
+		return
+	}
+
+	uid := c.MustGet("userID").(uint)
+	if err := config.DB.Model(&models.User{}).Where("id = ?", uid).Update(column, url).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{column: url})
+}
+
+func clearProfileImage(c *gin.Context, column string) {
+	uid := c.MustGet("userID").(uint)
+	if err := config.DB.Model(&models.User{}).Where("id = ?", uid).Update(column, "").Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func UploadAvatar(c *gin.Context) { setProfileImage(c, "avatar_url") }
+func DeleteAvatar(c *gin.Context) { clearProfileImage(c, "avatar_url") }
+func UploadCover(c *gin.Context)  { setProfileImage(c, "cover_url") }
+func DeleteCover(c *gin.Context)  { clearProfileImage(c, "cover_url") }
+
+// ===============================
+// Privacy Settings Controller
+// ===============================
+type PrivacyDTO struct {
+	ShowEmail *bool `json:"show_email"`
+	ShowPhone *bool `json:"show_phone"`
+}
+
+// UpdatePrivacy changes what the user's public profile shows. Fields left
+// out keep their value.
+func UpdatePrivacy(c *gin.Context) {
+	var body PrivacyDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := c.MustGet("userID").(uint)
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if body.ShowEmail != nil {
+		updates["privacy_show_email"] = *body.ShowEmail
+	}
+	if body.ShowPhone != nil {
+		updates["privacy_show_phone"] = *body.ShowPhone
+	}
+	if len(updates) > 0 {
+		if err := config.DB.Model(&user).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update privacy settings"})
+			return
+		}
+	}
+
+	config.DB.First(&user, uid)
+	c.JSON(http.StatusOK, gin.H{"privacy": user.Privacy, "profile": user.Public()})
+}
+
+// contactChange describes one of the two contact fields that can only be
+// changed after the new value has been confirmed.
+type contactChange struct {
+	kind    string // as shown in messages
+	column  string
+	purpose models.OTPPurpose
+	channel notify.Channel
+	current func(models.User) string
+	allowed func(models.User, string) error // optional extra rules for the new value
+}
+
+var (
+	emailChange = contactChange{
+		kind:    "email address",
+		column:  "email",
+		purpose: models.OTPChangeEmail,
+		channel: notify.Email,
+		current: func(u models.User) string { return u.Email },
+		allowed: func(u models.User, email string) error { return emailAllowed(email, u.InviteID != nil) },
+	}
+	phoneChange = contactChange{
+		kind:    "phone number",
+		column:  "phone",
+		purpose: models.OTPChangePhone,
+		channel: notify.SMS,
+		current: func(u models.User) string { return u.Phone },
+	}
+)
+
+// inUse reports whether another account already has value.
+func (cc contactChange) inUse(value string, userID uint) bool {
+	var n int64
+	config.DB.Model(&models.User{}).Where(cc.column+" = ? AND id <> ?", value, userID).Count(&n)
+	return n > 0
+}
+
+// notifyOld tells the current address about a change. Accounts without a
+// phone number simply aren't notified about phone changes.
+func (cc contactChange) notifyOld(c *gin.Context, user models.User, template, newValue string) {
+	old := cc.current(user)
+	if old == "" {
+		return
+	}
+	err := notify.SendTemplate(c.Request.Context(), cc.channel, old, template, gin.H{
+		"Name":     user.FirstName,
+		"Kind":     cc.kind,
+		"NewValue": newValue,
+	})
+	if err != nil {
+		log.Printf("%s change notice failed: %v", cc.column, err)
+	}
+}
+
+// request sends a code to the new value and warns the current one.
+func (cc contactChange) request(c *gin.Context, value string) {
+	uid := c.MustGet("userID").(uint)
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if value == cc.current(user) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "That is already your " + cc.kind})
+		return
+	}
+	if cc.inUse(value, user.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "That " + cc.kind + " is already in use"})
+		return
+	}
+	if cc.allowed != nil && admissionFailed(c, cc.allowed(user, value)) {
+		return
+	}
+
+	otp, err := issueOTP(user.ID, cc.purpose, value)
+	if err != nil {
+		otpError(c, err)
+		return
+	}
+	if err := sendOTPTo(c, user, cc.channel, value, otp, cc.purpose); err != nil {
+		log.Println("OTP delivery failed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send OTP"})
+		return
+	}
+	cc.notifyOld(c, user, "contact_change_requested", value)
+
+	c.JSON(http.StatusOK, gin.H{"message": "OTP sent to the new " + cc.kind})
+}
+
+// confirm swaps in the new value once its code checks out. The unique index
+// has the final word if another account claimed the value in the meantime.
+func (cc contactChange) confirm(c *gin.Context, code string) {
+	uid := c.MustGet("userID").(uint)
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	keys := throttleKeys(c, "", &user)
+	if checkLockout(c, keys) {
+		return
+	}
+	action := "account." + cc.column + "_change"
+	otp, err := checkOTP(user.ID, cc.purpose, code)
+	if err != nil {
+		if err != errOTPExpired {
+			recordFailure(c, keys, &user)
+		}
+		audit(c, action, user.ID, auditTarget("user", user.ID), auditFailure, err.Error())
+		otpError(c, err)
+		return
+	}
+	clearFailures(keys)
+
+	updates := map[string]interface{}{cc.column: otp.Target}
+	if cc.purpose == models.OTPChangePhone {
+		updates["phone_verified"] = true
+	}
+	err = config.DB.Model(&user).Updates(updates).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{"error": "That " + cc.kind + " is already in use"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update " + cc.kind})
+		return
+	}
+
+	// user still holds the old value here
+	audit(c, action, user.ID, auditTarget("user", user.ID), auditSuccess, cc.current(user)+" -> "+otp.Target)
+	cc.notifyOld(c, user, "contact_changed", otp.Target)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Your " + cc.kind + " was changed"})
+}
+
+// ===============================
+// Change Email / Phone Controllers
+// ===============================
+func RequestEmailChange(c *gin.Context) {
+	type EmailDTO struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	var body EmailDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	emailChange.request(c, body.Email)
+}
+
+func ConfirmEmailChange(c *gin.Context) {
+	type ConfirmDTO struct {
+		OTP string `json:"otp" binding:"required"`
+	}
+	var body ConfirmDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	emailChange.confirm(c, body.OTP)
+}
+
+func RequestPhoneChange(c *gin.Context) {
+	type PhoneDTO struct {
+		Phone string `json:"phone" binding:"required"`
+	}
+	var body PhoneDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	phoneChange.request(c, body.Phone)
+}
+
+func ConfirmPhoneChange(c *gin.Context) {
+	type ConfirmDTO struct {
+		OTP string `json:"otp" binding:"required"`
+	}
+	var body ConfirmDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	phoneChange.confirm(c, body.OTP)
+}
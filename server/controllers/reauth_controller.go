@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+	"blogapp/notify"
+	"blogapp/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ===============================
+// Re-authentication Controllers
+// ===============================
+
+// ReauthOTP emails a code for POST /auth/reauth, for users without a
+// password or who prefer not to type it.
+func ReauthOTP(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	otp, err := issueOTP(user.ID, models.OTPReauth, "")
+	if err != nil {
+		otpError(c, err)
+		return
+	}
+	if err := sendOTP(c, user, notify.Email, otp, models.OTPReauth); err != nil {
+		log.Println("OTP delivery failed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send OTP"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "OTP sent to your email address"})
+}
+
+// Reauth checks the password or an OTP from ReauthOTP again, plus a TOTP or
+// recovery code for users with 2FA, and returns a short-lived access token
+// for the same session whose auth_time is now. Routes behind
+// RequireRecentAuth accept it until it expires.
+func Reauth(c *gin.Context) {
+	type ReauthDTO struct {
+		Password string `json:"password"`
+		OTP      string `json:"otp"`
+		Code     string `json:"code"`
+	}
+
+	var body ReauthDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (body.Password == "") == (body.OTP == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either password or otp"})
+		return
+	}
+
+	uid := c.MustGet("userID").(uint)
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	// Step-up mustn't be weaker than logging in
+	if user.TOTPEnabled && body.Code == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "2FA code required", "two_factor_required": true})
+		return
+	}
+
+	keys := throttleKeys(c, "", &user)
+	if checkLockout(c, keys) {
+		return
+	}
+
+	if body.Password != "" {
+		if user.Password == "" || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.Password)) != nil {
+			recordFailure(c, keys, &user)
+			audit(c, "auth.reauth", user.ID, auditTarget("user", user.ID), auditFailure, "password")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+			return
+		}
+	} else {
+		if _, err := checkOTP(user.ID, models.OTPReauth, body.OTP); err != nil {
+			if err != errOTPExpired {
+				recordFailure(c, keys, &user)
+			}
+			audit(c, "auth.reauth", user.ID, auditTarget("user", user.ID), auditFailure, "otp: "+err.Error())
+			otpError(c, err)
+			return
+		}
+	}
+	if user.TOTPEnabled && !checkSecondFactor(user, body.Code) {
+		recordFailure(c, keys, &user)
+		audit(c, "auth.reauth", user.ID, auditTarget("user", user.ID), auditFailure, "2fa code")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid 2FA code"})
+		return
+	}
+	clearFailures(keys)
+
+	sid := c.MustGet("sessionID").(uint)
+	now := time.Now()
+	token, err := utils.GenerateJWT(config.Keys, user.ID, sid, user.Role, user.Permissions, config.C.ReauthTokenTTL, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+	method := "password"
+	if body.OTP != "" {
+		method = "otp"
+	}
+	if user.TOTPEnabled {
+		method += "+totp"
+	}
+	audit(c, "auth.reauth", user.ID, auditTarget("session", sid), auditSuccess, method)
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_in": int(config.C.ReauthTokenTTL.Seconds()),
+		"auth_time":  now,
+	})
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+	"blogapp/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errRefreshReuse = errors.New("refresh token reuse")
+
+// issueTokens starts a new session for the user and returns the access and
+// refresh token pair every login flow responds with.
+func issueTokens(c *gin.Context, user models.User, method string) (gin.H, error) {
+	ua := c.Request.UserAgent()
+	session := models.Session{
+		UserID:      user.ID,
+		UserAgent:   ua,
+		IP:          c.ClientIP(),
+		DeviceLabel: utils.DeviceLabel(ua),
+		LastSeenAt:  time.Now(),
+	}
+	if err := config.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	tokens, err := issueTokenPair(config.DB, user, session)
+	if err != nil {
+		return nil, err
+	}
+	audit(c, "auth.login", user.ID, auditTarget("session", session.ID), auditSuccess, method)
+	loginSucceeded(c, user, session, method)
+	if cancelDeletion(user) {
+		tokens["deletion_cancelled"] = true
+		audit(c, "account.delete_cancel", user.ID, auditTarget("user", user.ID), auditSuccess, "")
+	}
+	return tokens, nil
+}
+
+// issueTokenPair issues an access token and a fresh refresh token for an
+// existing session. The user's role and permissions are copied into the
+// access token, so changes to them apply from the next refresh on. Its
+// auth_time stays the session's login time however often it is refreshed.
+func issueTokenPair(tx *gorm.DB, user models.User, session models.Session) (gin.H, error) {
+	refresh, err := utils.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	rt := models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: utils.HashToken(refresh),
+		ExpiresAt: time.Now().Add(config.C.RefreshTokenTTL),
+	}
+	if err := tx.Create(&rt).Error; err != nil {
+		return nil, err
+	}
+
+	access, err := utils.GenerateJWT(config.Keys, user.ID, session.ID, user.Role, user.Permissions, config.C.AccessTokenTTL, session.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"token":         access,
+		"refresh_token": refresh,
+		"expires_in":    int(config.C.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// revokeSessions marks the matching, still active sessions as revoked.
+func revokeSessions(query interface{}, args ...interface{}) error {
+	return config.DB.Model(&models.Session{}).
+		Where(query, args...).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now()).Error
+}
+
+// ===============================
+// Refresh Token Controller
+// ===============================
+func Refresh(c *gin.Context) {
+	type RefreshDTO struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	var body RefreshDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rt models.RefreshToken
+	if err := config.DB.Preload("Session.User").Where("token_hash = ?", utils.HashToken(body.RefreshToken)).First(&rt).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+
+	if rt.Session.RevokedAt != nil || rt.Session.User.ID == 0 || time.Now().After(rt.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+
+	var tokens gin.H
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Claiming the token with a conditional update makes rotation safe
+		// against two concurrent refreshes with the same token.
+		res := tx.Model(&rt).Where("used_at IS NULL").Update("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errRefreshReuse
+		}
+
+		var err error
+		tokens, err = issueTokenPair(tx, rt.Session.User, rt.Session)
+		return err
+	})
+	if err == errRefreshReuse {
+		// A consumed token came back: either the client or an attacker holds
+		// a stolen copy, so the whole family is killed.
+		revokeSessions("id = ?", rt.SessionID)
+		audit(c, "auth.refresh", rt.Session.UserID, auditTarget("session", rt.SessionID), auditFailure, "refresh token reuse, session revoked")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reuse detected, session revoked"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// ===============================
+// Logout Controller
+// ===============================
+func Logout(c *gin.Context) {
+	sid := c.MustGet("sessionID").(uint)
+	if err := revokeSessions("id = ?", sid); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to logout"})
+		return
+	}
+	audit(c, "auth.logout", c.MustGet("userID").(uint), auditTarget("session", sid), auditSuccess, "")
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+func LogoutAll(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	if err := revokeSessions("user_id = ?", uid); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to logout"})
+		return
+	}
+	audit(c, "auth.logout_all", uid, auditTarget("user", uid), auditSuccess, "")
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions"})
+}
+
+// ===============================
+// Active Sessions Controllers
+// ===============================
+func GetSessions(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	sid := c.MustGet("sessionID").(uint)
+
+	var sessions []models.Session
+	config.DB.Where("user_id = ? AND revoked_at IS NULL", uid).Order("last_seen_at desc").Find(&sessions)
+
+	type sessionView struct {
+		ID          uint      `json:"id"`
+		DeviceLabel string    `json:"device_label"`
+		UserAgent   string    `json:"user_agent"`
+		IP          string    `json:"ip"`
+		CreatedAt   time.Time `json:"created_at"`
+		LastSeenAt  time.Time `json:"last_seen_at"`
+		Current     bool      `json:"current"`
+	}
+	data := make([]sessionView, 0, len(sessions))
+	for _, s := range sessions {
+		data = append(data, sessionView{
+			ID:          s.ID,
+			DeviceLabel: s.DeviceLabel,
+			UserAgent:   s.UserAgent,
+			IP:          s.IP,
+			CreatedAt:   s.CreatedAt,
+			LastSeenAt:  s.LastSeenAt,
+			Current:     s.ID == sid,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+func DeleteSession(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+
+	res := config.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), uid).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	audit(c, "session.revoke", uid, "session:"+c.Param("id"), auditSuccess, "")
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// JWKS publishes the public keys access tokens are signed with so other
+// services can verify them.
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": config.Keys.JWKS()})
+}
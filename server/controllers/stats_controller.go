@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Lengths in days of the series GET /auth/me/stats can return
+var statsPeriods = []int{30, 90}
+
+// How many of the author's most liked posts the stats list
+const topPostsLimit = 5
+
+type statsPoint struct {
+	Date  string `json:"date"` // UTC day, YYYY-MM-DD
+	Count int64  `json:"count"`
+}
+
+type topPost struct {
+	ID        uint      `json:"id"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	Likes     int64     `json:"likes"`
+	Comments  int64     `json:"comments"`
+}
+
+// dailySeries counts the rows of q per UTC day of created_at, for the days
+// from since to today. Days without rows are included with a count of 0.
+func dailySeries(q *gorm.DB, since time.Time, days int) []statsPoint {
+	var rows []struct {
+		Day   string
+		Count int64
+	}
+	q.Select("TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, COUNT(*) AS count").
+		Where("created_at >= ?", since).
+		Group("day").
+		Scan(&rows)
+	counts := map[string]int64{}
+	for _, r := range rows {
+		counts[r.Day] = r.Count
+	}
+
+	series := make([]statsPoint, days)
+	for i := range series {
+		day := since.AddDate(0, 0, i).Format("2006-01-02")
+		series[i] = statsPoint{Date: day, Count: counts[day]}
+	}
+	return series
+}
+
+// ===============================
+// Author Stats Controller
+// ===============================
+
+// GetMyStats is the author dashboard: totals over all of the user's posts,
+// drafts included, their most liked posts and daily series of new posts,
+// likes, comments and followers for the last ?days=30 (default) or 90 days.
+func GetMyStats(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || !slices.Contains(statsPeriods, days) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be 30 or 90"})
+		return
+	}
+
+	var totals struct {
+		Posts            int64 `json:"posts"`
+		Published        int64 `json:"published"`
+		Drafts           int64 `json:"drafts"`
+		LikesReceived    int64 `json:"likes_received"`
+		CommentsReceived int64 `json:"comments_received"`
+		Followers        int64 `json:"followers"`
+	}
+	mine := config.DB.Model(&models.Blog{}).Select("id").Where("author_id = ?", uid)
+	config.DB.Model(&models.Blog{}).
+		Select("COUNT(*) AS posts, COUNT(*) FILTER (WHERE status = ?) AS drafts", models.BlogDraft).
+		Where("author_id = ?", uid).
+		Scan(&totals)
+	totals.Published = totals.Posts - totals.Drafts
+	config.DB.Model(&models.Like{}).Where("blog_id IN (?)", mine).Count(&totals.LikesReceived)
+	config.DB.Model(&models.Comment{}).Where("blog_id IN (?)", mine).Count(&totals.CommentsReceived)
+	totals.Followers, _ = followCounts(uid)
+
+	top := []topPost{}
+	config.DB.Model(&models.Blog{}).
+		Select(`id, title, status, created_at,
+			(SELECT COUNT(*) FROM likes WHERE likes.blog_id = blogs.id) AS likes,
+			(SELECT COUNT(*) FROM comments WHERE comments.blog_id = blogs.id AND comments.deleted_at IS NULL) AS comments`).
+		Where("author_id = ?", uid).
+		Order("likes desc, comments desc, id desc").
+		Limit(topPostsLimit).
+		Scan(&top)
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, 1-days)
+
+	c.JSON(http.StatusOK, gin.H{
+		"totals":    totals,
+		"top_posts": top,
+		"days":      days,
+		"since":     since.Format("2006-01-02"),
+		"series": gin.H{
+			"posts":     dailySeries(config.DB.Model(&models.Blog{}).Where("author_id = ?", uid), since, days),
+			"likes":     dailySeries(config.DB.Model(&models.Like{}).Where("blog_id IN (?)", mine), since, days),
+			"comments":  dailySeries(config.DB.Model(&models.Comment{}).Where("blog_id IN (?)", mine), since, days),
+			"followers": dailySeries(config.DB.Model(&models.Follow{}).Where("followee_id = ?", uid), since, days),
+		},
+	})
+}
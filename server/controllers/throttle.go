@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Failed logins and code guesses are counted per client IP, per identifier
+// the client typed and per account. Once a counter passes its limit the key
+// is locked for lockoutBase, doubling with every further failure up to
+// lockoutMax. Identifiers are counted whether or not an account exists, so
+// lockouts look the same for real and made-up accounts.
+const (
+	accountFailureLimit = 5
+	ipFailureLimit      = 20
+	lockoutBase         = 30 * time.Second
+	lockoutMax          = time.Hour
+	failureWindow       = time.Hour // counters reset after this long without failures
+)
+
+const msgLockedOut = "Too many failed attempts. Please try again later."
+
+// throttleKeys returns the counters an authentication attempt is charged to.
+// user may be nil when the identifier didn't match an account.
+func throttleKeys(c *gin.Context, identifier string, user *models.User) []string {
+	keys := []string{"ip:" + c.ClientIP()}
+	if identifier != "" {
+		keys = append(keys, "id:"+strings.ToLower(strings.TrimSpace(identifier)))
+	}
+	if user != nil {
+		keys = append(keys, fmt.Sprintf("user:%d", user.ID))
+	}
+	return keys
+}
+
+func failureLimit(key string) int {
+	if strings.HasPrefix(key, "ip:") {
+		return ipFailureLimit
+	}
+	return accountFailureLimit
+}
+
+// checkLockout aborts the request with 429 when any of the keys is locked.
+func checkLockout(c *gin.Context, keys []string) bool {
+	var locked models.AuthThrottle
+	err := config.DB.Where("key IN ? AND locked_until > ?", keys, time.Now()).
+		Order("locked_until desc").
+		First(&locked).Error
+	if err != nil {
+		return false
+	}
+
+	retry := int(math.Ceil(time.Until(locked.LockedUntil).Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retry))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": msgLockedOut})
+	return true
+}
+
+// recordFailure bumps the counters for keys and locks the ones that went
+// over their limit. Every new lockout is written to the security log.
+func recordFailure(c *gin.Context, keys []string, user *models.User) {
+	now := time.Now()
+	for _, key := range keys {
+		t := models.AuthThrottle{Key: key, Failures: 1, LastFailureAt: now}
+		err := config.DB.Clauses(
+			clause.OnConflict{
+				Columns: []clause.Column{{Name: "key"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"failures":        gorm.Expr("CASE WHEN auth_throttles.last_failure_at < ? THEN 1 ELSE auth_throttles.failures + 1 END", now.Add(-failureWindow)),
+					"last_failure_at": now,
+				}),
+			},
+			clause.Returning{},
+		).Create(&t).Error
+		if err != nil {
+			continue
+		}
+
+		over := t.Failures - failureLimit(key)
+		if over < 0 {
+			continue
+		}
+		lock := lockoutBase << min(over, 16)
+		if lock > lockoutMax {
+			lock = lockoutMax
+		}
+		config.DB.Model(&t).Update("locked_until", now.Add(lock))
+
+		ev := models.SecurityEvent{
+			Kind:   "lockout",
+			Key:    key,
+			IP:     c.ClientIP(),
+			Detail: fmt.Sprintf("%d failed attempts, locked for %s", t.Failures, lock),
+		}
+		if user != nil {
+			ev.UserID = &user.ID
+		}
+		config.DB.Create(&ev)
+	}
+}
+
+// clearFailures resets the identifier and account counters after a
+// successful attempt. The IP counter is left alone so one valid account
+// can't be used to keep guessing others.
+func clearFailures(keys []string) {
+	var reset []string
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "ip:") {
+			reset = append(reset, key)
+		}
+	}
+	if len(reset) > 0 {
+		config.DB.Where("key IN ?", reset).Delete(&models.AuthThrottle{})
+	}
+}
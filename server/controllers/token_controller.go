@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+	"blogapp/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// ===============================
+// Personal Access Token Controllers
+// ===============================
+func GetTokens(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	var tokens []models.PersonalAccessToken
+	config.DB.Where("user_id = ?", uid).Order("created_at desc").Find(&tokens)
+	c.JSON(http.StatusOK, gin.H{"data": tokens})
+}
+
+func CreateToken(c *gin.Context) {
+	type TokenDTO struct {
+		Name          string   `json:"name" binding:"required,max=100"`
+		Scopes        []string `json:"scopes" binding:"required,min=1"`
+		ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=3650"`
+	}
+
+	var body TokenDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, s := range body.Scopes {
+		if !utils.ValidScope(s) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope " + s, "valid_scopes": utils.AllScopes})
+			return
+		}
+	}
+
+	secret, err := utils.GenerateToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+	raw := utils.PATPrefix + secret
+
+	pat := models.PersonalAccessToken{
+		UserID:    c.MustGet("userID").(uint),
+		Name:      body.Name,
+		Prefix:    raw[:len(utils.PATPrefix)+4],
+		TokenHash: utils.HashToken(raw),
+		Scopes:    pq.StringArray(body.Scopes),
+	}
+	if body.ExpiresInDays > 0 {
+		exp := time.Now().AddDate(0, 0, body.ExpiresInDays)
+		pat.ExpiresAt = &exp
+	}
+	if err := config.DB.Create(&pat).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+
+	audit(c, "token.create", pat.UserID, auditTarget("token", pat.ID), auditSuccess, "scopes: "+strings.Join(pat.Scopes, ","))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Copy the token now, it won't be shown again.",
+		"token":   raw,
+		"data":    pat,
+	})
+}
+
+func DeleteToken(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	res := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), uid).Delete(&models.PersonalAccessToken{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete token"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+		return
+	}
+	audit(c, "token.delete", uid, "token:"+c.Param("id"), auditSuccess, "")
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// DeleteAllTokens deletes every personal access token of the user, e.g.
+// after one of them leaked.
+func DeleteAllTokens(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	res := config.DB.Where("user_id = ?", uid).Delete(&models.PersonalAccessToken{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete tokens"})
+		return
+	}
+	audit(c, "token.delete", uid, auditTarget("user", uid), auditSuccess, fmt.Sprintf("all %d tokens", res.RowsAffected))
+	c.JSON(http.StatusOK, gin.H{"ok": true, "deleted": res.RowsAffected})
+}
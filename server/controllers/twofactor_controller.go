@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+	"blogapp/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	twoFactorChallenge    = "2fa"
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount     = 10
+)
+
+// checkSecondFactor accepts either a current TOTP code or an unused
+// recovery code. Both are single use.
+func checkSecondFactor(user models.User, code string) bool {
+	if step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		// The conditional update rejects a code whose step was already used,
+		// including by a concurrent request.
+		res := config.DB.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		return res.Error == nil && res.RowsAffected == 1
+	}
+
+	// Codes issued before they were hashed with HashRecoveryCode were keyed
+	// with OTP_SECRET and still work as long as it hasn't changed.
+	hashes := []string{utils.HashRecoveryCode(code), utils.HashOTP(config.C.OTPSecret, utils.NormalizeRecoveryCode(code))}
+	res := config.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash IN ? AND used_at IS NULL", user.ID, hashes).
+		Update("used_at", time.Now())
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+// newRecoveryCodes replaces the user's recovery codes and returns the new
+// ones in plaintext. They can't be shown again afterwards.
+func newRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		rows = append(rows, models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashRecoveryCode(code),
+		})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// ===============================
+// 2FA Setup Controller
+// ===============================
+func Setup2FA(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "2FA already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate secret"})
+		return
+	}
+	uri := utils.TOTPURI(config.C.AppName, user.Email, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate QR code"})
+		return
+	}
+
+	config.DB.Model(&user).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_url": uri,
+		"qr_png":      "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// ===============================
+// 2FA Confirm Controller
+// ===============================
+func Confirm2FA(c *gin.Context) {
+	type ConfirmDTO struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	var body ConfirmDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := c.MustGet("userID").(uint)
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "2FA already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "2FA setup not started"})
+		return
+	}
+
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, body.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	var codes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = newRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable 2FA"})
+		return
+	}
+	audit(c, "2fa.enable", user.ID, auditTarget("user", user.ID), auditSuccess, "totp")
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "2FA enabled. Store these recovery codes somewhere safe, they won't be shown again.",
+		"recovery_codes": codes,
+	})
+}
+
+// ===============================
+// 2FA Verify Controller (second login step)
+// ===============================
+func Verify2FA(c *gin.Context) {
+	type VerifyDTO struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+
+	var body VerifyDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid, err := utils.ParseChallengeToken(config.Keys, body.ChallengeToken, twoFactorChallenge)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired challenge"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired challenge"})
+		return
+	}
+
+	keys := throttleKeys(c, "", &user)
+	if checkLockout(c, keys) {
+		return
+	}
+	if !checkSecondFactor(user, body.Code) {
+		recordFailure(c, keys, &user)
+		loginFailed(c, user.ID, "2fa:totp", "wrong code")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+	clearFailures(keys)
+
+	tokens, err := issueTokens(c, user, "2fa:totp")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	tokens["message"] = "Login successful"
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// ===============================
+// 2FA Disable Controller
+// ===============================
+func Disable2FA(c *gin.Context) {
+	type DisableDTO struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	var body DisableDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := c.MustGet("userID").(uint)
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "2FA is not enabled"})
+		return
+	}
+
+	keys := throttleKeys(c, "", &user)
+	if checkLockout(c, keys) {
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.Password)) != nil || !checkSecondFactor(user, body.Code) {
+		recordFailure(c, keys, &user)
+		audit(c, "2fa.disable", user.ID, auditTarget("user", user.ID), auditFailure, "wrong password or code")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password or code"})
+		return
+	}
+	clearFailures(keys)
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable 2FA"})
+		return
+	}
+	audit(c, "2fa.disable", user.ID, auditTarget("user", user.ID), auditSuccess, "totp")
+
+	c.JSON(http.StatusOK, gin.H{"message": "2FA disabled"})
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"blogapp/config"
+	"blogapp/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// findUserByRef looks a user up by "@handle" (any case) or numeric id, the
+// two forms /users/:ref accepts.
+func findUserByRef(ref string) (models.User, error) {
+	var user models.User
+	if handle, ok := strings.CutPrefix(ref, "@"); ok {
+		err := config.DB.Where("LOWER(handle) = LOWER(?) AND handle <> ''", handle).First(&user).Error
+		return user, err
+	}
+	id, err := strconv.ParseUint(ref, 10, 64)
+	if err != nil {
+		return user, err
+	}
+	err = config.DB.First(&user, id).Error
+	return user, err
+}
+
+// ===============================
+// Public Profile Controller
+// ===============================
+
+// GetProfile is a user's public page: the PublicUser view, a page of their
+// published posts (newest first) and totals across all of them.
+func GetProfile(c *gin.Context) {
+	user, err := findUserByRef(c.Param("ref"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	page, limit, offset := pagination(c)
+
+	var posts []models.Blog
+	config.DB.Scopes(published).Where("author_id = ?", user.ID).Order("created_at desc").Limit(limit).Offset(offset).Find(&posts)
+	for i := range posts {
+		posts[i].Author = user
+	}
+
+	var stats struct {
+		Posts            int64 `json:"posts"`
+		LikesReceived    int64 `json:"likes_received"`
+		CommentsReceived int64 `json:"comments_received"`
+		Followers        int64 `json:"followers"`
+		Following        int64 `json:"following"`
+	}
+	mine := config.DB.Model(&models.Blog{}).Scopes(published).Select("id").Where("author_id = ?", user.ID)
+	config.DB.Model(&models.Blog{}).Scopes(published).Where("author_id = ?", user.ID).Count(&stats.Posts)
+	config.DB.Model(&models.Like{}).Where("blog_id IN (?)", mine).Count(&stats.LikesReceived)
+	config.DB.Model(&models.Comment{}).Where("blog_id IN (?)", mine).Count(&stats.CommentsReceived)
+	stats.Followers, stats.Following = followCounts(user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":      user.Public(),
+		"joined_at": user.CreatedAt,
+		"stats":     stats,
+		"posts":     posts,
+		"page":      page,
+		"limit":     limit,
+	})
+}
+
+// GetUserBlogs lists a user's posts, newest first. Their author also sees
+// drafts and can pick with ?status=draft|published; everyone else only
+// sees published posts.
+func GetUserBlogs(c *gin.Context) {
+	user, err := findUserByRef(c.Param("ref"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	page, limit, offset := pagination(c)
+
+	q := config.DB.Model(&models.Blog{}).Where("author_id = ?", user.ID)
+	if uid, ok := c.Get("userID"); ok && uid.(uint) == user.ID {
+		switch status := c.Query("status"); status {
+		case models.BlogDraft, models.BlogPublished:
+			q = q.Where("status = ?", status)
+		}
+	} else {
+		q = q.Scopes(published)
+	}
+
+	var total int64
+	var blogs []models.Blog
+	q.Count(&total)
+	q.Order("created_at desc, id desc").Limit(limit).Offset(offset).Find(&blogs)
+	for i := range blogs {
+		blogs[i].Author = user
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  blogs,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+		"likes": likeCounts(blogs),
+	})
+}
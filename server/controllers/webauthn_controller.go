@@ -0,0 +1,371 @@
+package controllers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+	"blogapp/utils"
+	"blogapp/webauthn"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const webauthnChallengeTTL = 5 * time.Minute
+
+// Ceremonies a WebAuthn challenge can be issued for
+const (
+	webauthnRegister = "register"
+	webauthnLogin    = "login"
+	webauthn2FA      = "2fa"
+)
+
+// newWebAuthnChallenge stores a fresh challenge for purpose.
+func newWebAuthnChallenge(purpose string, userID uint) (string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	// Abandoned ceremonies are cleaned up here rather than by a separate job
+	config.DB.Where("expires_at < ?", time.Now()).Delete(&models.WebAuthnChallenge{})
+
+	err = config.DB.Create(&models.WebAuthnChallenge{
+		Challenge: challenge,
+		Purpose:   purpose,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(webauthnChallengeTTL),
+	}).Error
+	return challenge, err
+}
+
+// takeWebAuthnChallenge consumes the stored challenge that clientDataJSON
+// answers. Like OIDC states, the row is deleted as it is read so a response
+// can't be replayed.
+func takeWebAuthnChallenge(clientDataJSON []byte, purpose string, userID uint) (string, bool) {
+	cd, err := webauthn.ParseClientData(clientDataJSON)
+	if err != nil {
+		return "", false
+	}
+	var ch models.WebAuthnChallenge
+	res := config.DB.Clauses(clause.Returning{}).
+		Where("challenge = ? AND purpose = ? AND user_id = ?", cd.Challenge, purpose, userID).
+		Delete(&ch)
+	if res.Error != nil || res.RowsAffected == 0 || time.Now().After(ch.ExpiresAt) {
+		return "", false
+	}
+	return ch.Challenge, true
+}
+
+// userHandle is the opaque user id passkeys are stored under.
+func userHandle(userID uint) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
+
+func credentialDescriptors(userID uint) []webauthn.CredentialDescriptor {
+	var creds []models.WebAuthnCredential
+	config.DB.Where("user_id = ?", userID).Find(&creds)
+	list := make([]webauthn.CredentialDescriptor, 0, len(creds))
+	for _, cred := range creds {
+		list = append(list, webauthn.CredentialDescriptor{Type: "public-key", ID: cred.CredentialID, Transports: cred.Transports})
+	}
+	return list
+}
+
+func hasPasskey(userID uint) bool {
+	var n int64
+	config.DB.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&n)
+	return n > 0
+}
+
+// checkPasskey verifies an assertion against cred and records the new
+// signature counter. A counter that went backwards is written to the
+// security log.
+func checkPasskey(c *gin.Context, res *webauthn.AssertionResponse, challenge string, cred models.WebAuthnCredential, requireUV bool) bool {
+	count, err := webauthn.RP.VerifyAssertion(res, challenge, cred.PublicKey, cred.SignCount, requireUV)
+	if errors.Is(err, webauthn.ErrClonedCredential) {
+		config.DB.Create(&models.SecurityEvent{
+			Kind:   "webauthn_counter",
+			Key:    fmt.Sprintf("user:%d", cred.UserID),
+			UserID: &cred.UserID,
+			IP:     c.ClientIP(),
+			Detail: fmt.Sprintf("credential %d reported counter %d, stored %d", cred.ID, count, cred.SignCount),
+		})
+	}
+	if err != nil {
+		log.Println("webauthn:", err)
+		return false
+	}
+
+	config.DB.Model(&cred).Updates(map[string]interface{}{
+		"sign_count":   count,
+		"last_used_at": time.Now(),
+	})
+	return true
+}
+
+// ===============================
+// Passkey Registration Controllers
+// ===============================
+func WebAuthnRegisterOptions(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	challenge, err := newWebAuthnChallenge(webauthnRegister, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start registration"})
+		return
+	}
+
+	displayName := user.FirstName + " " + user.LastName
+	opts := webauthn.RP.CreationOptions(challenge, userHandle(user.ID), user.Email, displayName, credentialDescriptors(user.ID))
+	c.JSON(http.StatusOK, gin.H{"publicKey": opts})
+}
+
+func WebAuthnRegisterVerify(c *gin.Context) {
+	type RegisterDTO struct {
+		Name       string                        `json:"name" binding:"max=100"`
+		Credential webauthn.RegistrationResponse `json:"credential" binding:"required"`
+	}
+
+	var body RegisterDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid := c.MustGet("userID").(uint)
+	challenge, ok := takeWebAuthnChallenge(body.Credential.Response.ClientDataJSON, webauthnRegister, uid)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired registration request"})
+		return
+	}
+
+	cred, err := webauthn.RP.VerifyRegistration(&body.Credential, challenge, false)
+	if err != nil {
+		log.Println("webauthn:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey could not be verified"})
+		return
+	}
+
+	if body.Name == "" {
+		body.Name = utils.DeviceLabel(c.Request.UserAgent())
+	}
+	record := models.WebAuthnCredential{
+		UserID:       uid,
+		Name:         body.Name,
+		CredentialID: cred.ID,
+		PublicKey:    cred.PublicKey,
+		SignCount:    cred.SignCount,
+		AAGUID:       cred.AAGUID,
+		Transports:   pq.StringArray(cred.Transports),
+	}
+	err = config.DB.Create(&record).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This passkey is already registered"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save passkey"})
+		return
+	}
+	audit(c, "passkey.add", uid, auditTarget("passkey", record.ID), auditSuccess, record.Name)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Passkey added", "data": record})
+}
+
+// ===============================
+// Passkey Management Controllers
+// ===============================
+func GetWebAuthnCredentials(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	var creds []models.WebAuthnCredential
+	config.DB.Where("user_id = ?", uid).Order("created_at desc").Find(&creds)
+	c.JSON(http.StatusOK, gin.H{"data": creds})
+}
+
+func DeleteWebAuthnCredential(c *gin.Context) {
+	uid := c.MustGet("userID").(uint)
+	res := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), uid).Delete(&models.WebAuthnCredential{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete passkey"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "passkey not found"})
+		return
+	}
+	audit(c, "passkey.remove", uid, "passkey:"+c.Param("id"), auditSuccess, "")
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// ===============================
+// Passkey Login Controllers
+// ===============================
+
+// WebAuthnLoginOptions starts a passwordless login. No account is named, so
+// the browser offers every passkey it has for this site and the endpoint
+// says nothing about which accounts exist.
+func WebAuthnLoginOptions(c *gin.Context) {
+	challenge, err := newWebAuthnChallenge(webauthnLogin, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"publicKey": webauthn.RP.RequestOptions(challenge, nil, "required")})
+}
+
+// WebAuthnLoginVerify logs in with a passkey. The authenticator has to
+// verify the user (PIN or biometrics), which already makes it two factors,
+// so no further 2FA step follows.
+func WebAuthnLoginVerify(c *gin.Context) {
+	type LoginDTO struct {
+		Credential webauthn.AssertionResponse `json:"credential" binding:"required"`
+	}
+
+	var body LoginDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	keys := throttleKeys(c, "", nil)
+	if checkLockout(c, keys) {
+		return
+	}
+
+	challenge, ok := takeWebAuthnChallenge(body.Credential.Response.ClientDataJSON, webauthnLogin, 0)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired login request"})
+		return
+	}
+
+	var cred models.WebAuthnCredential
+	err := config.DB.Preload("User").Where("credential_id = ?", []byte(body.Credential.RawID)).First(&cred).Error
+	handle := body.Credential.Response.UserHandle
+	if err != nil || (len(handle) > 0 && string(handle) != string(userHandle(cred.UserID))) ||
+		!checkPasskey(c, &body.Credential, challenge, cred, true) {
+		recordFailure(c, keys, nil)
+		if cred.UserID != 0 {
+			loginFailed(c, cred.UserID, "passkey", "verification failed")
+		} else {
+			audit(c, "auth.login", 0, "", auditFailure, "passkey: unknown credential")
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey login failed"})
+		return
+	}
+	user := cred.User
+	clearFailures(append(keys, fmt.Sprintf("user:%d", user.ID)))
+
+	tokens, err := issueTokens(c, user, "passkey")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	tokens["message"] = "Login successful"
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// ===============================
+// Passkey Second Factor Controllers
+// ===============================
+
+// WebAuthn2FAOptions is the passkey alternative to a TOTP code in the
+// second login step. It takes the challenge token returned by Login.
+func WebAuthn2FAOptions(c *gin.Context) {
+	type OptionsDTO struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+	}
+
+	var body OptionsDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid, err := utils.ParseChallengeToken(config.Keys, body.ChallengeToken, twoFactorChallenge)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired challenge"})
+		return
+	}
+	allow := credentialDescriptors(uid)
+	if len(allow) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No passkey registered"})
+		return
+	}
+
+	challenge, err := newWebAuthnChallenge(webauthn2FA, uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start verification"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"publicKey": webauthn.RP.RequestOptions(challenge, allow, "discouraged")})
+}
+
+func WebAuthn2FAVerify(c *gin.Context) {
+	type VerifyDTO struct {
+		ChallengeToken string                     `json:"challenge_token" binding:"required"`
+		Credential     webauthn.AssertionResponse `json:"credential" binding:"required"`
+	}
+
+	var body VerifyDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uid, err := utils.ParseChallengeToken(config.Keys, body.ChallengeToken, twoFactorChallenge)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired challenge"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired challenge"})
+		return
+	}
+
+	keys := throttleKeys(c, "", &user)
+	if checkLockout(c, keys) {
+		return
+	}
+
+	challenge, ok := takeWebAuthnChallenge(body.Credential.Response.ClientDataJSON, webauthn2FA, uid)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired verification request"})
+		return
+	}
+
+	var cred models.WebAuthnCredential
+	err = config.DB.Where("credential_id = ? AND user_id = ?", []byte(body.Credential.RawID), uid).First(&cred).Error
+	if err != nil || !checkPasskey(c, &body.Credential, challenge, cred, false) {
+		recordFailure(c, keys, &user)
+		loginFailed(c, user.ID, "2fa:passkey", "verification failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey verification failed"})
+		return
+	}
+	clearFailures(keys)
+
+	tokens, err := issueTokens(c, user, "2fa:passkey")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	tokens["message"] = "Login successful"
+
+	c.JSON(http.StatusOK, tokens)
+}
@@ -3,10 +3,17 @@ package main
 import (
 	"log"
 	"net/http"
+	"time"
 
 	"blogapp/config"
+	"blogapp/controllers"
+	"blogapp/middleware"
 	"blogapp/models"
+	"blogapp/notify"
+	"blogapp/oidc"
 	"blogapp/routes"
+	"blogapp/utils"
+	"blogapp/webauthn"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -14,7 +21,12 @@ import (
 
 func main() {
 	config.Load()
+	config.LoadKeys()
+	config.LoadPasswordPolicy()
 	config.ConnectDB()
+	notify.Init()
+	oidc.Init()
+	webauthn.Init()
 
 	// Migrations
 	if err := config.DB.AutoMigrate(&models.User{}, &models.Blog{}, &models.Comment{}, &models.Like{}); err != nil {
@@ -27,10 +39,49 @@ func main() {
 		&models.Blog{},
 		&models.Comment{},
 		&models.Like{},
+		&models.OTPCode{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+		&models.OIDCState{},
+		&models.AuthThrottle{},
+		&models.SecurityEvent{},
+		&models.AuditEvent{},
+		&models.LoginEvent{},
+		&models.PersonalAccessToken{},
+		&models.Invite{},
+		&models.WebAuthnCredential{},
+		&models.WebAuthnChallenge{},
+		&models.Follow{},
+		&models.Block{},
+		&models.Mute{},
+		&models.Notification{},
+		&models.NotificationPreference{},
 	); err != nil {
 		log.Fatal("migration error:", err)
 	}
+
+	// The phone index used to cover empty numbers too, replaced by
+	// idx_users_phone_nonempty above
+	if config.DB.Migrator().HasIndex(&models.User{}, "idx_users_phone") {
+		if err := config.DB.Migrator().DropIndex(&models.User{}, "idx_users_phone"); err != nil {
+			log.Fatal("migration error:", err)
+		}
+	}
 	
+	if err := controllers.InstallAuditGuard(); err != nil {
+		log.Fatal("migration error:", err)
+	}
+
+	// Bootstrap the first admin account
+	if config.C.AdminEmail != "" {
+		config.DB.Model(&models.User{}).Where("email = ?", config.C.AdminEmail).Update("role", utils.RoleAdmin)
+	}
+
+	middleware.StartLastSeenFlusher(time.Minute)
+	controllers.StartAccountPurger(time.Hour)
+	controllers.StartAuditRetention(24 * time.Hour)
 
 	r := gin.Default()
 	r.Use(cors.New(cors.Config{
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"blogapp/config"
+	"blogapp/models"
+)
+
+// usage collects the sessions and personal access tokens used since the
+// last flush so that AuthRequired doesn't have to write to the database on
+// every request.
+var usage = struct {
+	sync.Mutex
+	sessions map[uint]struct{}
+	tokens   map[uint]struct{}
+}{sessions: map[uint]struct{}{}, tokens: map[uint]struct{}{}}
+
+func touchSession(id uint) {
+	usage.Lock()
+	usage.sessions[id] = struct{}{}
+	usage.Unlock()
+}
+
+func touchToken(id uint) {
+	usage.Lock()
+	usage.tokens[id] = struct{}{}
+	usage.Unlock()
+}
+
+// StartLastSeenFlusher writes the collected last-seen/last-used times every
+// interval, with one UPDATE per table. The times are therefore accurate to
+// about one interval.
+func StartLastSeenFlusher(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			flushLastSeen()
+		}
+	}()
+}
+
+func flushLastSeen() {
+	usage.Lock()
+	sessions, tokens := keys(usage.sessions), keys(usage.tokens)
+	usage.sessions, usage.tokens = map[uint]struct{}{}, map[uint]struct{}{}
+	usage.Unlock()
+
+	now := time.Now()
+	if len(sessions) > 0 {
+		err := config.DB.Model(&models.Session{}).Where("id IN ?", sessions).UpdateColumn("last_seen_at", now).Error
+		if err != nil {
+			log.Println("last seen flush failed:", err)
+		}
+	}
+	if len(tokens) > 0 {
+		err := config.DB.Model(&models.PersonalAccessToken{}).Where("id IN ?", tokens).UpdateColumn("last_used_at", now).Error
+		if err != nil {
+			log.Println("last used flush failed:", err)
+		}
+	}
+}
+
+func keys(m map[uint]struct{}) []uint {
+	ids := make([]uint, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	return ids
+}
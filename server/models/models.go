@@ -7,6 +7,10 @@ import (
 	"gorm.io/gorm"
 )
 
+// User is an account. It is never written out in full: its JSON is the
+// PublicUser view (see views.go), so a user embedded as a blog's Author or
+// a comment's User can't leak private fields. Handlers showing more build a
+// SelfUser or AdminUser explicitly.
 type User struct {
 	ID            uint           `gorm:"primaryKey" json:"id"`
 	CreatedAt     time.Time      `json:"created_at"`
@@ -16,28 +20,290 @@ type User struct {
 	FirstName     string `json:"first_name"`
 	LastName      string `json:"last_name"`
 	Email         string `gorm:"uniqueIndex" json:"email"`
-	Phone         string `gorm:"uniqueIndex" json:"phone"`
+	// Accounts created through OIDC login have no phone, so uniqueness
+	// only applies to non-empty numbers.
+	Phone         string `gorm:"uniqueIndex:idx_users_phone_nonempty,where:phone <> ''" json:"phone"`
 	Password      string `json:"-"`
 
 	Bio           string `json:"bio"`
 	IsOTPVerified bool   `gorm:"default:false" json:"is_otp_verified"`
 
-	// ✅ OTP Fields Added
-	OTPCode    string    `json:"-"` // OTP hidden in response
-	OTPExpires time.Time `json:"-"`
+	// Public profile. Handles are unique regardless of case; accounts
+	// created before handles existed have none.
+	Handle      string         `gorm:"size:30;uniqueIndex:idx_users_handle_lower,expression:LOWER(handle),where:handle <> ''" json:"handle"`
+	AvatarURL   string         `json:"avatar_url"`
+	CoverURL    string         `json:"cover_url"`
+	Website     string         `json:"website"`
+	Location    string         `gorm:"size:100" json:"location"`
+	SocialLinks pq.StringArray `gorm:"type:text[];default:'{}'" json:"social_links"`
+
+	// Role is one of reader, author, editor or admin (see utils/rbac.go).
+	// Permissions are granted on top of the role's own.
+	Role        string         `gorm:"size:16;not null;default:author" json:"role"`
+	Permissions pq.StringArray `gorm:"type:text[];default:'{}'" json:"permissions"`
+
+	PhoneVerified bool   `gorm:"default:false" json:"phone_verified"`
+
+	// TOTP two-factor authentication. TOTPSecret is set during setup and
+	// only takes effect once TOTPEnabled is switched on by confirming a code.
+	TOTPSecret   string `json:"-"`
+	TOTPEnabled  bool   `gorm:"default:false" json:"two_factor_enabled"`
+	TOTPLastStep int64  `json:"-"` // last accepted time step, blocks code replay
+
+	// DeleteAfter is set when the user asks to delete the account. Logging
+	// in before then cancels the request; afterwards the account is purged.
+	DeleteAfter *time.Time `gorm:"index" json:"delete_after,omitempty"`
+
+	// InviteID is the invite the user registered with, if any
+	InviteID *uint `gorm:"index" json:"invite_id,omitempty"`
+
+	// PasswordResetRequired blocks password logins until the password is
+	// reset, e.g. after the user reported a login that wasn't theirs.
+	PasswordResetRequired bool `gorm:"default:false" json:"password_reset_required"`
+
+	Privacy UserPrivacy `gorm:"embedded;embeddedPrefix:privacy_" json:"privacy"`
 }
 
+// UserPrivacy holds what a user shares on their public profile. Everything
+// defaults to hidden.
+type UserPrivacy struct {
+	ShowEmail bool `gorm:"default:false" json:"show_email"`
+	ShowPhone bool `gorm:"default:false" json:"show_phone"`
+}
 
+// RecoveryCode is a one-time backup code for when the TOTP device is lost.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
 
-type Blog struct {
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+type OTPPurpose string
+
+const (
+	OTPVerifyEmail   OTPPurpose = "verify_email"
+	OTPVerifyPhone   OTPPurpose = "verify_phone"
+	OTPResetPassword OTPPurpose = "reset_password"
+	OTPLogin         OTPPurpose = "login"
+	OTPChangeEmail   OTPPurpose = "change_email"
+	OTPChangePhone   OTPPurpose = "change_phone"
+	OTPMagicLink     OTPPurpose = "magic_link" // the code is the link token's jti
+	OTPReauth        OTPPurpose = "reauth"
+)
+
+// OTPCode is a pending one-time code. A user has at most one code per
+// purpose; issuing a new code replaces the previous one and a code is
+// deleted once it has been used.
+type OTPCode struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID     uint       `gorm:"not null;uniqueIndex:idx_otp_user_purpose" json:"user_id"`
+	Purpose    OTPPurpose `gorm:"size:32;not null;uniqueIndex:idx_otp_user_purpose" json:"purpose"`
+	Target     string     `json:"-"` // the new address for change_email/change_phone
+	CodeHash   string     `gorm:"not null" json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Attempts   int        `gorm:"not null;default:0" json:"attempts"`
+	LastSentAt time.Time  `json:"last_sent_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// provider, identified by the provider's subject claim.
+type UserIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Provider  string    `gorm:"size:64;not null;uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject   string    `gorm:"not null;uniqueIndex:idx_identity_provider_subject" json:"-"`
+	Email     string    `json:"email"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// OIDCState is an authorization request in flight. It is created when the
+// user is sent to the provider and consumed by the callback.
+type OIDCState struct {
+	State        string    `gorm:"primaryKey" json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	Provider     string    `gorm:"size:64;not null" json:"provider"`
+	Nonce        string    `gorm:"not null" json:"-"`
+	CodeVerifier string    `gorm:"not null" json:"-"`
+	InviteCode   string    `json:"-"` // used if the login creates an account
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// AuthThrottle counts recent failed authentication attempts for one key,
+// e.g. "ip:203.0.113.7", "id:jane@example.com" or "user:42".
+type AuthThrottle struct {
+	Key           string    `gorm:"primaryKey;size:320" json:"key"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Failures      int       `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until"`
+}
+
+// SecurityEvent is an entry of the security log, e.g. an account lockout.
+type SecurityEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	Kind      string    `gorm:"size:64;not null;index" json:"kind"`
+	Key       string    `json:"key"`
+	UserID    *uint     `gorm:"index" json:"user_id"`
+	IP        string    `json:"ip"`
+	Detail    string    `json:"detail"`
+}
+
+// AuditEvent is an entry in the append-only audit log. Rows are never
+// updated, and only the retention job deletes them (see
+// controllers/audit.go). ActorID has no foreign key so the history
+// outlives deleted accounts.
+type AuditEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	ActorID   *uint     `gorm:"index" json:"actor_id"`
+	IP        string    `gorm:"size:64" json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Action    string    `gorm:"size:64;not null;index" json:"action"`
+	Target    string    `gorm:"size:128;index" json:"target"`
+	Outcome   string    `gorm:"size:16;not null" json:"outcome"`
+	Detail    string    `json:"detail"`
+}
+
+// LoginEvent is an entry in a user's login history. Failed attempts are
+// only recorded once the account is known, i.e. not for unknown emails.
+type LoginEvent struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time `gorm:"index" json:"created_at"`
+	UserID      uint      `gorm:"not null;index" json:"-"`
+	SessionID   *uint     `json:"session_id"`
+	Method      string    `gorm:"size:64" json:"method"` // e.g. "password", "passkey", "oidc:google"
+	Success     bool      `json:"success"`
+	Reason      string    `json:"reason,omitempty"` // why it failed
+	IP          string    `gorm:"size:64" json:"ip"`
+	Network     string    `gorm:"size:64" json:"-"` // see utils.IPNetwork
+	UserAgent   string    `json:"user_agent"`
+	DeviceLabel string    `json:"device_label"`
+	NewDevice   bool      `json:"new_device"` // an alert was sent
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// Session is a single login. The refresh tokens issued for it form one
+// rotation family: every refresh consumes the current token and issues the
+// next, and presenting an already consumed token revokes the whole session.
+type Session struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	DeniedAt  *time.Time `json:"denied_at,omitempty"` // reported through a login alert
+
+	// Device details captured at login
+	UserAgent   string    `json:"user_agent"`
+	IP          string    `json:"ip"`
+	DeviceLabel string    `json:"device_label"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	SessionID uint       `gorm:"not null;index" json:"session_id"`
+	TokenHash string     `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+
+	Session Session `gorm:"foreignKey:SessionID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// PersonalAccessToken is a long-lived token a user creates for scripts and
+// CI. Only its hash is stored; Prefix is kept so users can tell their
+// tokens apart.
+type PersonalAccessToken struct {
 	ID         uint           `gorm:"primaryKey" json:"id"`
 	CreatedAt  time.Time      `json:"created_at"`
+	UserID     uint           `gorm:"not null;index" json:"user_id"`
+	Name       string         `gorm:"not null" json:"name"`
+	Prefix     string         `gorm:"size:16;not null" json:"prefix"`
+	TokenHash  string         `gorm:"not null;uniqueIndex" json:"-"`
+	Scopes     pq.StringArray `gorm:"type:text[];default:'{}'" json:"scopes"`
+	ExpiresAt  *time.Time     `json:"expires_at"`
+	LastUsedAt *time.Time     `json:"last_used_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// Invite lets someone register while REGISTRATION_MODE is "invite". Like
+// personal access tokens only a hash of the code is kept. Invites are
+// revoked rather than deleted so users.invite_id keeps pointing somewhere.
+type Invite struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CreatedByID *uint      `gorm:"index" json:"created_by_id"`
+	Note        string     `json:"note"`
+	Prefix      string     `gorm:"size:16;not null" json:"prefix"`
+	CodeHash    string     `gorm:"not null;uniqueIndex" json:"-"`
+	MaxUses     int        `gorm:"not null" json:"max_uses"`
+	Uses        int        `gorm:"not null;default:0" json:"uses"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+}
+
+// WebAuthnCredential is a passkey or security key registered by a user.
+// PublicKey is the COSE_Key from the authenticator.
+type WebAuthnCredential struct {
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UserID       uint           `gorm:"not null;index" json:"user_id"`
+	Name         string         `json:"name"`
+	CredentialID []byte         `gorm:"not null;uniqueIndex" json:"-"`
+	PublicKey    []byte         `gorm:"not null" json:"-"`
+	SignCount    uint32         `gorm:"not null;default:0" json:"-"`
+	AAGUID       []byte         `json:"-"`
+	Transports   pq.StringArray `gorm:"type:text[];default:'{}'" json:"transports"`
+	LastUsedAt   *time.Time     `json:"last_used_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// WebAuthnChallenge is a pending WebAuthn ceremony. It is deleted when the
+// response comes in, so each challenge can only be answered once. UserID
+// is 0 for passkey logins, where the user isn't known yet.
+type WebAuthnChallenge struct {
+	Challenge string    `gorm:"primaryKey" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	Purpose   string    `gorm:"size:16;not null" json:"purpose"`
+	UserID    uint      `gorm:"not null;default:0" json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+const (
+	BlogPublished = "published"
+	BlogDraft     = "draft"
+)
+
+type Blog struct {
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time      `gorm:"index:idx_blogs_author_created,priority:2" json:"created_at"`
 	UpdatedAt  time.Time      `json:"updated_at"`
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
 
 	Title      string `json:"title"`
 	Content    string `json:"content"` 
-	AuthorID   uint   `json:"author_id"`
+	AuthorID   uint   `gorm:"index:idx_blogs_author_created,priority:1" json:"author_id"`
+	Status     string `gorm:"size:16;not null;default:published;index" json:"status"` // BlogDraft posts are only visible to their author
 	Author     User   `gorm:"foreignKey:AuthorID;constraint:OnDelete:CASCADE;" json:"author"`
 	ImageURL string `json:"image_url"` // ✅ Optional blog image
 	// ✅ Many-to-Many Relationship with User via likes table
@@ -73,3 +339,78 @@ type Like struct {
 
 	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"user"`
 }
+
+// Follow subscribes FollowerID to the posts of FolloweeID, for GET /feed.
+type Follow struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	FollowerID uint      `gorm:"not null;uniqueIndex:idx_follows_pair" json:"follower_id"`
+	FolloweeID uint      `gorm:"not null;uniqueIndex:idx_follows_pair;index" json:"followee_id"`
+
+	Follower User `gorm:"foreignKey:FollowerID;constraint:OnDelete:CASCADE;" json:"-"`
+	Followee User `gorm:"foreignKey:FolloweeID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// Block stops BlockedID from commenting on, liking or following BlockerID's
+// posts and from notifying them.
+type Block struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	BlockerID uint      `gorm:"not null;uniqueIndex:idx_blocks_pair" json:"blocker_id"`
+	BlockedID uint      `gorm:"not null;uniqueIndex:idx_blocks_pair;index" json:"blocked_id"`
+
+	Blocker User `gorm:"foreignKey:BlockerID;constraint:OnDelete:CASCADE;" json:"-"`
+	Blocked User `gorm:"foreignKey:BlockedID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// Mute hides MutedID's posts and comments from MuterID. The muted user
+// isn't told and can still interact.
+type Mute struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	MuterID   uint      `gorm:"not null;uniqueIndex:idx_mutes_pair" json:"muter_id"`
+	MutedID   uint      `gorm:"not null;uniqueIndex:idx_mutes_pair" json:"muted_id"`
+
+	Muter User `gorm:"foreignKey:MuterID;constraint:OnDelete:CASCADE;" json:"-"`
+	Muted User `gorm:"foreignKey:MutedID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+const (
+	NotifyLike    = "like"
+	NotifyComment = "comment"
+	NotifyFollow  = "follow"
+	NotifyMention = "mention"
+)
+
+var NotificationTypes = []string{NotifyLike, NotifyComment, NotifyFollow, NotifyMention}
+
+// Notification tells UserID that someone liked or commented on their post,
+// followed them or mentioned them. Unread notifications with the same
+// GroupKey (type and post) are one row listing the actors, most recent
+// first; once read, the next event starts a new row.
+type Notification struct {
+	ID        uint          `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `gorm:"index:idx_notifications_user_updated,priority:2" json:"updated_at"`
+	UserID    uint          `gorm:"not null;index:idx_notifications_user_updated,priority:1;uniqueIndex:idx_notifications_unread_group,where:read_at IS NULL" json:"-"`
+	GroupKey  string        `gorm:"size:64;not null;uniqueIndex:idx_notifications_unread_group,where:read_at IS NULL" json:"-"`
+	Type      string        `gorm:"size:16;not null" json:"type"`
+	BlogID    *uint         `json:"blog_id"`
+	CommentID *uint         `json:"comment_id"` // the latest comment
+	ActorIDs  pq.Int64Array `gorm:"type:bigint[];not null;default:'{}'" json:"-"`
+	ReadAt    *time.Time    `json:"read_at"`
+
+	User User  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	Blog *Blog `gorm:"foreignKey:BlogID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// NotificationPreference overrides the default delivery of one
+// notification type for a user.
+type NotificationPreference struct {
+	UserID uint   `gorm:"primaryKey" json:"-"`
+	Type   string `gorm:"primaryKey;size:16" json:"type"`
+	InApp  bool   `gorm:"not null" json:"in_app"`
+	Email  bool   `gorm:"not null" json:"email"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PublicUser is what anyone can see about a user: their profile, plus the
+// contact details they chose to share.
+type PublicUser struct {
+	ID          uint           `json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	FirstName   string         `json:"first_name"`
+	LastName    string         `json:"last_name"`
+	Handle      string         `json:"handle,omitempty"`
+	Bio         string         `json:"bio"`
+	AvatarURL   string         `json:"avatar_url,omitempty"`
+	CoverURL    string         `json:"cover_url,omitempty"`
+	Website     string         `json:"website,omitempty"`
+	Location    string         `json:"location,omitempty"`
+	SocialLinks pq.StringArray `json:"social_links,omitempty"`
+	Role        string         `json:"role"`
+	Email       string         `json:"email,omitempty"`
+	Phone       string         `json:"phone,omitempty"`
+	Deleted     bool           `json:"deleted,omitempty"` // the account was deleted and anonymized
+}
+
+// SelfUser is the user's own view of their account.
+type SelfUser struct {
+	ID                    uint           `json:"id"`
+	CreatedAt             time.Time      `json:"created_at"`
+	UpdatedAt             time.Time      `json:"updated_at"`
+	FirstName             string         `json:"first_name"`
+	LastName              string         `json:"last_name"`
+	Email                 string         `json:"email"`
+	Phone                 string         `json:"phone"`
+	Handle                string         `json:"handle"`
+	Bio                   string         `json:"bio"`
+	AvatarURL             string         `json:"avatar_url"`
+	CoverURL              string         `json:"cover_url"`
+	Website               string         `json:"website"`
+	Location              string         `json:"location"`
+	SocialLinks           pq.StringArray `json:"social_links"`
+	IsOTPVerified         bool           `json:"is_otp_verified"`
+	PhoneVerified         bool           `json:"phone_verified"`
+	Role                  string         `json:"role"`
+	Permissions           pq.StringArray `json:"permissions"`
+	TwoFactorEnabled      bool           `json:"two_factor_enabled"`
+	HasPassword           bool           `json:"has_password"`
+	PasswordResetRequired bool           `json:"password_reset_required"`
+	DeleteAfter           *time.Time     `json:"delete_after,omitempty"`
+	Privacy               UserPrivacy    `json:"privacy"`
+}
+
+// AdminUser is what admins see: the user's own view plus bookkeeping.
+type AdminUser struct {
+	SelfUser
+	InviteID  *uint      `json:"invite_id"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func (u User) Public() PublicUser {
+	p := PublicUser{
+		ID:          u.ID,
+		CreatedAt:   u.CreatedAt,
+		FirstName:   u.FirstName,
+		LastName:    u.LastName,
+		Handle:      u.Handle,
+		Bio:         u.Bio,
+		AvatarURL:   u.AvatarURL,
+		CoverURL:    u.CoverURL,
+		Website:     u.Website,
+		Location:    u.Location,
+		SocialLinks: u.SocialLinks,
+		Role:        u.Role,
+		Deleted:     u.DeletedAt.Valid,
+	}
+	if u.Privacy.ShowEmail {
+		p.Email = u.Email
+	}
+	if u.Privacy.ShowPhone {
+		p.Phone = u.Phone
+	}
+	return p
+}
+
+func (u User) Self() SelfUser {
+	return SelfUser{
+		ID:                    u.ID,
+		CreatedAt:             u.CreatedAt,
+		UpdatedAt:             u.UpdatedAt,
+		FirstName:             u.FirstName,
+		LastName:              u.LastName,
+		Email:                 u.Email,
+		Phone:                 u.Phone,
+		Handle:                u.Handle,
+		Bio:                   u.Bio,
+		AvatarURL:             u.AvatarURL,
+		CoverURL:              u.CoverURL,
+		Website:               u.Website,
+		Location:              u.Location,
+		SocialLinks:           u.SocialLinks,
+		IsOTPVerified:         u.IsOTPVerified,
+		PhoneVerified:         u.PhoneVerified,
+		Role:                  u.Role,
+		Permissions:           u.Permissions,
+		TwoFactorEnabled:      u.TOTPEnabled,
+		HasPassword:           u.Password != "",
+		PasswordResetRequired: u.PasswordResetRequired,
+		DeleteAfter:           u.DeleteAfter,
+		Privacy:               u.Privacy,
+	}
+}
+
+func (u User) Admin() AdminUser {
+	a := AdminUser{SelfUser: u.Self(), InviteID: u.InviteID}
+	if u.DeletedAt.Valid {
+		a.DeletedAt = &u.DeletedAt.Time
+	}
+	return a
+}
+
+// MarshalJSON writes the public view; see User.
+func (u User) MarshalJSON() ([]byte, error) {
+	return json.Marshal(u.Public())
+}
+
+// AdminUsers converts a page of users for an admin listing.
+func AdminUsers(users []User) []AdminUser {
+	out := make([]AdminUser, len(users))
+	for i, u := range users {
+		out[i] = u.Admin()
+	}
+	return out
+}
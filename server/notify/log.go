@@ -0,0 +1,29 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// LogNotifier writes messages to a writer instead of delivering them.
+// It is meant for local development.
+type LogNotifier struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogNotifier(w io.Writer) *LogNotifier {
+	return &LogNotifier{w: w}
+}
+
+func (l *LogNotifier) Send(_ context.Context, msg Message) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := fmt.Fprintf(l.w, "---- %s %s to %s ----\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), msg.Channel, msg.To, msg.Subject, msg.Text)
+	return err
+}
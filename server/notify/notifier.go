@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"blogapp/config"
+)
+
+// Channel is the medium a message is delivered over.
+type Channel string
+
+const (
+	Email Channel = "email"
+	SMS   Channel = "sms"
+)
+
+// Message is a single outbound notification. Email deliveries use Subject,
+// Text and HTML; SMS deliveries only use Text.
+type Message struct {
+	Channel Channel
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Notifier delivers a Message to its recipient.
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Router dispatches a message to the notifier configured for its channel.
+type Router struct {
+	Email Notifier
+	SMS   Notifier
+}
+
+func (r Router) Send(ctx context.Context, msg Message) error {
+	switch msg.Channel {
+	case Email:
+		if r.Email != nil {
+			return r.Email.Send(ctx, msg)
+		}
+	case SMS:
+		if r.SMS != nil {
+			return r.SMS.Send(ctx, msg)
+		}
+	}
+	return fmt.Errorf("notify: no notifier configured for channel %q", msg.Channel)
+}
+
+// N is the notifier used by the controllers. It is set up by Init.
+var N Notifier = Router{Email: NewLogNotifier(os.Stdout), SMS: NewLogNotifier(os.Stdout)}
+
+// Init builds N from config.C. It must be called after config.Load.
+func Init() {
+	var logNotifier Notifier = NewLogNotifier(os.Stdout)
+	if config.C.NotifyLogFile != "" {
+		f, err := os.OpenFile(config.C.NotifyLogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Fatal("notify: cannot open log file:", err)
+		}
+		logNotifier = NewLogNotifier(f)
+	}
+
+	r := Router{Email: logNotifier, SMS: logNotifier}
+
+	switch config.C.NotifyEmailDriver {
+	case "smtp":
+		r.Email = &SMTPNotifier{
+			Host:     config.C.SMTPHost,
+			Port:     config.C.SMTPPort,
+			Username: config.C.SMTPUsername,
+			Password: config.C.SMTPPassword,
+			From:     config.C.SMTPFrom,
+		}
+	case "log", "":
+	default:
+		log.Fatalf("notify: unknown email driver %q", config.C.NotifyEmailDriver)
+	}
+
+	switch config.C.NotifySMSDriver {
+	case "http":
+		r.SMS = &SMSNotifier{
+			URL:    config.C.SMSAPIURL,
+			APIKey: config.C.SMSAPIKey,
+			From:   config.C.SMSFrom,
+		}
+	case "log", "":
+	default:
+		log.Fatalf("notify: unknown sms driver %q", config.C.NotifySMSDriver)
+	}
+
+	N = r
+}
+
+// SendTemplate renders the named template with data and sends it to the
+// recipient over the given channel.
+func SendTemplate(ctx context.Context, ch Channel, to, name string, data any) error {
+	msg, err := Render(name, data)
+	if err != nil {
+		return err
+	}
+	msg.Channel = ch
+	msg.To = to
+	return N.Send(ctx, msg)
+}
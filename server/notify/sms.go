@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// SMSNotifier delivers text messages through an HTTP SMS gateway. The message
+// is POSTed as JSON ({"from", "to", "text"}) with the API key as a bearer
+// token; any 2xx response counts as accepted.
+type SMSNotifier struct {
+	URL    string
+	APIKey string
+	From   string
+
+	// Client is used for the gateway request. A client with a 10 second
+	// timeout is used when nil.
+	Client *http.Client
+}
+
+var defaultSMSClient = &http.Client{Timeout: 10 * time.Second}
+
+func (s *SMSNotifier) Send(ctx context.Context, msg Message) error {
+	if msg.Channel != SMS {
+		return fmt.Errorf("sms: unsupported channel %q", msg.Channel)
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"from": s.From,
+		"to":   msg.To,
+		"text": msg.Text,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = defaultSMSClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sms gateway error: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("sms gateway returned %s: %s", res.Status, bytes.TrimSpace(b))
+	}
+	return nil
+}
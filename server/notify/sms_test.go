@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSMS = Message{Channel: SMS, To: "+15550100", Text: "Your code is 123456"}
+
+func TestSMSSend(t *testing.T) {
+	var got map[string]string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer test-key" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("body: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer gateway.Close()
+
+	n := &SMSNotifier{URL: gateway.URL, APIKey: "test-key", From: "Blogify"}
+	if err := n.Send(context.Background(), testSMS); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	want := map[string]string{"from": "Blogify", "to": "+15550100", "text": "Your code is 123456"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestSMSGatewayError(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid number", http.StatusBadRequest)
+	}))
+	defer gateway.Close()
+
+	err := (&SMSNotifier{URL: gateway.URL}).Send(context.Background(), testSMS)
+	if err == nil || !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "invalid number") {
+		t.Fatalf("err = %v, want the 400 and its body", err)
+	}
+}
+
+func TestSMSGatewayTimeout(t *testing.T) {
+	release := make(chan struct{})
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer gateway.Close()
+	defer close(release)
+
+	t.Run("client timeout", func(t *testing.T) {
+		n := &SMSNotifier{URL: gateway.URL, Client: &http.Client{Timeout: 200 * time.Millisecond}}
+		if err := n.Send(context.Background(), testSMS); err == nil {
+			t.Fatal("Send succeeded against a hung gateway")
+		}
+	})
+
+	t.Run("context deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := (&SMSNotifier{URL: gateway.URL}).Send(ctx, testSMS); err == nil {
+			t.Fatal("Send succeeded against a hung gateway")
+		}
+		if d := time.Since(start); d > 2*time.Second {
+			t.Fatalf("Send took %v", d)
+		}
+	})
+}
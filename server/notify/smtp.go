@@ -0,0 +1,175 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTPNotifier sends email through an SMTP server. STARTTLS is used when the
+// server advertises it; authentication is only attempted when Username is set.
+type SMTPNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+
+	// Timeout bounds the whole exchange with the server, on top of any
+	// deadline of the context. 30 seconds when zero.
+	Timeout time.Duration
+}
+
+const defaultSMTPTimeout = 30 * time.Second
+
+func (s *SMTPNotifier) Send(ctx context.Context, msg Message) error {
+	if msg.Channel != Email {
+		return fmt.Errorf("smtp: unsupported channel %q", msg.Channel)
+	}
+
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("smtp: invalid from address: %v", err)
+	}
+
+	body, err := buildMIME(from.String(), msg)
+	if err != nil {
+		return err
+	}
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = defaultSMTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := s.send(ctx, from.Address, msg.To, body); err != nil {
+		return fmt.Errorf("smtp send error: %v", err)
+	}
+	return nil
+}
+
+// send is smtp.SendMail over a connection that gives up when ctx is done,
+// so a hung server can't block the request that sends the mail.
+func (s *SMTPNotifier) send(ctx context.Context, from, to string, body []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(s.Host, s.Port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Unblock reads and writes right away if ctx is cancelled early
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("server doesn't support AUTH")
+		}
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// buildMIME renders a multipart/alternative message with a plain-text and an
+// HTML part. The HTML part is omitted when msg.HTML is empty.
+func buildMIME(from string, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	boundary, err := randomBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if msg.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQP(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", msg.Text},
+		{"text/html", msg.HTML},
+	} {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQP(&buf, part.body); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+
+	return buf.Bytes(), nil
+}
+
+func writeQP(buf *bytes.Buffer, s string) error {
+	w := quotedprintable.NewWriter(buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func randomBoundary() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
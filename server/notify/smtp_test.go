@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpSink is a local SMTP server that accepts every message, or answers
+// RCPT with rejectRcpt when it is set.
+type smtpSink struct {
+	ln         net.Listener
+	rejectRcpt string
+	received   chan string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return &smtpSink{ln: ln, received: make(chan string, 1)}
+}
+
+func (s *smtpSink) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpSink) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 sink ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250-sink")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(cmd, "MAIL FROM"):
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO"):
+			if s.rejectRcpt != "" {
+				reply(s.rejectRcpt)
+			} else {
+				reply("250 OK")
+			}
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.received <- data.String()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *smtpSink) notifier() *SMTPNotifier {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	return &SMTPNotifier{Host: host, Port: port, From: "Blogify <no-reply@blogify.test>"}
+}
+
+var testEmail = Message{
+	Channel: Email,
+	To:      "ann@example.com",
+	Subject: "Your code",
+	Text:    "Your code is 123456",
+	HTML:    "<p>Your code is <b>123456</b></p>",
+}
+
+func TestSMTPSend(t *testing.T) {
+	sink := newSMTPSink(t)
+	go sink.serve()
+
+	if err := sink.notifier().Send(context.Background(), testEmail); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case data := <-sink.received:
+		for _, want := range []string{
+			"To: ann@example.com",
+			"Subject: Your code",
+			"multipart/alternative",
+			"Your code is 123456",
+			"<b>123456</b>",
+		} {
+			if !strings.Contains(data, want) {
+				t.Errorf("message doesn't contain %q:\n%s", want, data)
+			}
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("sink received nothing")
+	}
+}
+
+func TestSMTPRejectedRecipient(t *testing.T) {
+	sink := newSMTPSink(t)
+	sink.rejectRcpt = "550 no such user"
+	go sink.serve()
+
+	err := sink.notifier().Send(context.Background(), testEmail)
+	if err == nil || !strings.Contains(err.Error(), "550") {
+		t.Fatalf("err = %v, want the 550 reply", err)
+	}
+}
+
+// A server that accepts the connection but never answers must not block
+// the sender past its context deadline or Timeout.
+func TestSMTPHungServer(t *testing.T) {
+	sink := newSMTPSink(t)
+	var mu sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := sink.ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+
+	t.Run("context deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := sink.notifier().Send(ctx, testEmail); err == nil {
+			t.Fatal("Send succeeded against a silent server")
+		}
+		if d := time.Since(start); d > 2*time.Second {
+			t.Fatalf("Send took %v", d)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		n := sink.notifier()
+		n.Timeout = 200 * time.Millisecond
+		start := time.Now()
+		if err := n.Send(context.Background(), testEmail); err == nil {
+			t.Fatal("Send succeeded against a silent server")
+		}
+		if d := time.Since(start); d > 2*time.Second {
+			t.Fatalf("Send took %v", d)
+		}
+	})
+}
+
+func TestSMTPRejectsOtherChannels(t *testing.T) {
+	if err := (&SMTPNotifier{}).Send(context.Background(), Message{Channel: SMS}); err == nil {
+		t.Fatal("SMTP notifier accepted an SMS")
+	}
+}
@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"blogapp/config"
+)
+
+//go:embed templates/*
+var templateFS embed.FS
+
+// Each message kind lives in two files under templates/:
+//
+//	<name>.txt   defines a "subject" and a "text" block
+//	<name>.html  is the HTML body
+//
+// The HTML file is optional; SMS deliveries only use the text block.
+
+var funcs = map[string]any{
+	"appName": func() string { return config.C.AppName },
+}
+
+var (
+	textTemplates = map[string]*texttemplate.Template{}
+	htmlTemplates = map[string]*htmltemplate.Template{}
+)
+
+// Every file is parsed into its own template set so that the "subject" and
+// "text" blocks of different messages don't overwrite each other.
+func init() {
+	files, err := fs.Glob(templateFS, "templates/*")
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range files {
+		base := path.Base(f)
+		name := strings.TrimSuffix(base, path.Ext(base))
+		switch path.Ext(base) {
+		case ".txt":
+			textTemplates[name] = texttemplate.Must(texttemplate.New(base).Funcs(funcs).ParseFS(templateFS, f))
+		case ".html":
+			htmlTemplates[name] = htmltemplate.Must(htmltemplate.New(base).Funcs(funcs).ParseFS(templateFS, f))
+		}
+	}
+}
+
+// Render executes the named template with data.
+func Render(name string, data any) (Message, error) {
+	var msg Message
+
+	t, ok := textTemplates[name]
+	if !ok {
+		return msg, fmt.Errorf("notify: unknown template %q", name)
+	}
+
+	var subject, text bytes.Buffer
+	if err := t.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return msg, err
+	}
+	if err := t.ExecuteTemplate(&text, "text", data); err != nil {
+		return msg, err
+	}
+	msg.Subject = strings.TrimSpace(subject.String())
+	msg.Text = strings.TrimSpace(text.String())
+
+	if h, ok := htmlTemplates[name]; ok {
+		var html bytes.Buffer
+		if err := h.Execute(&html, data); err != nil {
+			return msg, err
+		}
+		msg.HTML = html.String()
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,43 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	"blogapp/config"
+)
+
+// Providers holds the configured issuers by name. It is set up by Init.
+var Providers = map[string]*Provider{}
+
+// Init builds Providers from config.C. It must be called after config.Load.
+func Init() {
+	for _, pc := range config.C.OIDCProviders {
+		Providers[pc.Name] = &Provider{
+			Name:         pc.Name,
+			Issuer:       pc.Issuer,
+			ClientID:     pc.ClientID,
+			ClientSecret: pc.ClientSecret,
+			RedirectURL:  strings.TrimSuffix(config.C.PublicURL, "/") + "/auth/oidc/" + pc.Name + "/callback",
+			Scopes:       pc.Scopes,
+		}
+	}
+}
+
+// RandomString returns a random URL-safe string, suitable for state,
+// nonce and PKCE verifier values.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge returns the S256 PKCE challenge for a verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
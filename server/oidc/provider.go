@@ -0,0 +1,313 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Provider is an OpenID Connect issuer Blogify can log users in with. Its
+// discovery document and signing keys are fetched on first use and cached.
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// Client is used for discovery, token and JWKS requests. A client with
+	// a 10 second timeout is used when nil.
+	Client *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]crypto.PublicKey
+	keysAt    time.Time
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the ID token claims Blogify uses.
+type Claims struct {
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Name          string `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// keysTTL bounds how long fetched signing keys are trusted before they are
+// fetched again. An unknown kid also triggers a refetch.
+const keysTTL = time.Hour
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+func (p *Provider) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return defaultClient
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := p.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// getDiscovery returns the cached discovery document, fetching it first if
+// needed. The fetch runs without holding mu, so a slow issuer doesn't hold
+// up key lookups; concurrent first logins may each fetch it once.
+func (p *Provider) getDiscovery(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	cached := p.discovery
+	p.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	var d discovery
+	u := strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, u, &d); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %v", err)
+	}
+	if d.Issuer != p.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer mismatch %q != %q", d.Issuer, p.Issuer)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery == nil {
+		p.discovery = &d
+	}
+	return p.discovery, nil
+}
+
+// AuthCodeURL returns the authorization endpoint URL the user is sent to.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.ClientID)
+	v.Set("redirect_uri", p.RedirectURL)
+	v.Set("scope", strings.Join(p.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", codeChallenge)
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange trades an authorization code for tokens and returns the raw ID
+// token. The ID token still has to be checked with Verify.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	res, err := p.client().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oidc token exchange: %v", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc token exchange: %s: %s", res.Status, body)
+	}
+
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return "", fmt.Errorf("oidc token exchange: %v", err)
+	}
+	if tok.IDToken == "" {
+		return "", errors.New("oidc token exchange: no id_token in response")
+	}
+	return tok.IDToken, nil
+}
+
+// Verify checks the ID token's signature, issuer, audience, expiry and
+// nonce and returns its claims.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("oidc id token: %v", err)
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("oidc id token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("oidc id token: missing subject")
+	}
+	return claims, nil
+}
+
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	fresh := time.Since(p.keysAt) < keysTTL
+	p.mu.Unlock()
+	if ok && fresh {
+		return key, nil
+	}
+
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %v", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := k.publicKey(); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.keysAt = time.Now()
+	p.mu.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("oidc jwks: unknown key %q", kid)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
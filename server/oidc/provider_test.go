@@ -0,0 +1,364 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "blogify"
+	testClientSecret = "s3cret"
+	testRedirectURL  = "http://localhost:8080/auth/oidc/mock/callback"
+)
+
+// mockProvider is a local OpenID Connect issuer. It serves discovery, a
+// token endpoint that enforces PKCE and a JWKS with one RSA key, and hands
+// out whatever ID token idToken builds for the code.
+type mockProvider struct {
+	t      *testing.T
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+	issuer string // issuer announced in discovery, the server URL by default
+
+	mu            sync.Mutex
+	challenges    map[string]string // code -> PKCE challenge
+	idToken       func(code string) string
+	jwksHits      atomic.Int32
+	discoveryHits atomic.Int32
+	onDiscovery   func(hit int32) // called before answering, may block
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{t: t, key: key, kid: "k1", challenges: map[string]string{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/token", m.token)
+	mux.HandleFunc("/jwks", m.jwks)
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	m.issuer = m.srv.URL
+	m.idToken = func(string) string { return m.sign(m.claims("nonce-1"), m.kid, m.key) }
+	return m
+}
+
+func (m *mockProvider) provider() *Provider {
+	return &Provider{
+		Name:         "mock",
+		Issuer:       m.srv.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+}
+
+func (m *mockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	hit := m.discoveryHits.Add(1)
+	if m.onDiscovery != nil {
+		m.onDiscovery(hit)
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 m.issuer,
+		"authorization_endpoint": m.srv.URL + "/authorize",
+		"token_endpoint":         m.srv.URL + "/token",
+		"jwks_uri":               m.srv.URL + "/jwks",
+	})
+}
+
+// authorize stands in for the user logging in at the provider: it issues
+// a code bound to the PKCE challenge of the authorization URL.
+func (m *mockProvider) authorize(authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != testClientID || q.Get("redirect_uri") != testRedirectURL {
+		m.t.Fatalf("unexpected authorization request %s", authURL)
+	}
+	code := "code-" + q.Get("state")
+	m.mu.Lock()
+	m.challenges[code] = q.Get("code_challenge")
+	m.mu.Unlock()
+	return code
+}
+
+func (m *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	if r.Method != http.MethodPost || id != testClientID || secret != testClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+	r.ParseForm()
+	code := r.PostForm.Get("code")
+	m.mu.Lock()
+	challenge, ok := m.challenges[code]
+	delete(m.challenges, code)
+	m.mu.Unlock()
+	if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != testRedirectURL ||
+		!ok || CodeChallenge(r.PostForm.Get("code_verifier")) != challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "at",
+		"token_type":   "Bearer",
+		"id_token":     m.idToken(code),
+	})
+}
+
+func (m *mockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	m.jwksHits.Add(1)
+	pub := m.key.PublicKey
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": m.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (m *mockProvider) claims(nonce string) *Claims {
+	now := time.Now()
+	return &Claims{
+		Nonce:         nonce,
+		Email:         "ann@example.com",
+		EmailVerified: true,
+		GivenName:     "Ann",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.srv.URL,
+			Subject:   "user-123",
+			Audience:  jwt.ClaimStrings{testClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+	}
+}
+
+func (m *mockProvider) sign(claims *Claims, kid string, key *rsa.PrivateKey) string {
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = kid
+	s, err := tok.SignedString(key)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return s
+}
+
+// login runs the authorization code flow up to the raw ID token.
+func login(t *testing.T, m *mockProvider, p *Provider) (string, error) {
+	t.Helper()
+	verifier, _ := RandomString()
+	authURL, err := p.AuthCodeURL(context.Background(), "state-1", "nonce-1", CodeChallenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	return p.Exchange(context.Background(), m.authorize(authURL), verifier)
+}
+
+func TestCodeFlowWithPKCE(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+
+	raw, err := login(t, m, p)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	claims, err := p.Verify(context.Background(), raw, "nonce-1")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims.Subject != "user-123" || claims.Email != "ann@example.com" || !claims.EmailVerified {
+		t.Fatalf("claims = %+v", claims)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+	verifier, _ := RandomString()
+	authURL, err := p.AuthCodeURL(context.Background(), "state-1", "nonce-1", CodeChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := m.authorize(authURL)
+	if _, err := p.Exchange(context.Background(), code, "not-the-verifier"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("err = %v, want invalid_grant", err)
+	}
+}
+
+func TestExchangeRejectsWrongClientSecret(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+	p.ClientSecret = "wrong"
+	if _, err := login(t, m, p); err == nil {
+		t.Fatal("exchange succeeded with a wrong client secret")
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockProvider(t)
+	m.issuer = "https://evil.example"
+	if _, err := m.provider().AuthCodeURL(context.Background(), "s", "n", "c"); err == nil || !strings.Contains(err.Error(), "issuer mismatch") {
+		t.Fatalf("err = %v, want an issuer mismatch", err)
+	}
+}
+
+func TestVerifyRejectsBadTokens(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name  string
+		token func(m *mockProvider) string
+		want  string
+	}{
+		{"nonce mismatch", func(m *mockProvider) string {
+			return m.sign(m.claims("some-other-nonce"), m.kid, m.key)
+		}, "nonce mismatch"},
+		{"issuer mismatch", func(m *mockProvider) string {
+			c := m.claims("nonce-1")
+			c.Issuer = "https://evil.example"
+			return m.sign(c, m.kid, m.key)
+		}, "issuer"},
+		{"audience mismatch", func(m *mockProvider) string {
+			c := m.claims("nonce-1")
+			c.Audience = jwt.ClaimStrings{"another-client"}
+			return m.sign(c, m.kid, m.key)
+		}, "audience"},
+		{"expired", func(m *mockProvider) string {
+			c := m.claims("nonce-1")
+			c.IssuedAt = jwt.NewNumericDate(time.Now().Add(-2 * time.Hour))
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+			return m.sign(c, m.kid, m.key)
+		}, "expired"},
+		{"no expiry", func(m *mockProvider) string {
+			c := m.claims("nonce-1")
+			c.ExpiresAt = nil
+			return m.sign(c, m.kid, m.key)
+		}, "exp"},
+		{"unknown kid", func(m *mockProvider) string {
+			return m.sign(m.claims("nonce-1"), "k2", otherKey)
+		}, "unknown key"},
+		{"wrong key for kid", func(m *mockProvider) string {
+			return m.sign(m.claims("nonce-1"), m.kid, otherKey)
+		}, "signature"},
+		{"missing subject", func(m *mockProvider) string {
+			c := m.claims("nonce-1")
+			c.Subject = ""
+			return m.sign(c, m.kid, m.key)
+		}, "subject"},
+		{"unsigned", func(m *mockProvider) string {
+			s, _ := jwt.NewWithClaims(jwt.SigningMethodNone, m.claims("nonce-1")).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return s
+		}, "signing method"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newMockProvider(t)
+			m.idToken = func(string) string { return tc.token(m) }
+			p := m.provider()
+
+			raw, err := login(t, m, p)
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			_, err = p.Verify(context.Background(), raw, "nonce-1")
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("err = %v, want one mentioning %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// An unknown kid refetches the JWKS, so rotated keys are picked up.
+func TestVerifyRefetchesKeysForUnknownKid(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+	raw, err := login(t, m, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(context.Background(), raw, "nonce-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.key, m.kid = rotated, "k2"
+	raw, err = login(t, m, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(context.Background(), raw, "nonce-1"); err != nil {
+		t.Fatalf("Verify after key rotation: %v", err)
+	}
+	if hits := m.jwksHits.Load(); hits != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", hits)
+	}
+}
+
+// A provider whose discovery endpoint hangs must not hold up every other
+// login through it.
+func TestSlowDiscoveryDoesNotBlockOtherLogins(t *testing.T) {
+	m := newMockProvider(t)
+	arrived, stall := make(chan struct{}), make(chan struct{})
+	m.onDiscovery = func(hit int32) {
+		if hit == 1 {
+			close(arrived)
+			<-stall
+		}
+	}
+	t.Cleanup(func() { close(stall) })
+	p := m.provider()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.AuthCodeURL(context.Background(), "s1", "n1", "c1")
+		done <- err
+	}()
+	<-arrived
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := p.AuthCodeURL(ctx, "s2", "n2", "c2"); err != nil {
+		t.Fatalf("second login blocked behind the stalled discovery: %v", err)
+	}
+	// Once published, the document is served from the cache.
+	if _, err := p.AuthCodeURL(context.Background(), "s3", "n3", "c3"); err != nil {
+		t.Fatal(err)
+	}
+	if hits := m.discoveryHits.Load(); hits != 2 {
+		t.Fatalf("discovery fetched %d times, want 2", hits)
+	}
+}
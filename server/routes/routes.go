@@ -1,35 +1,131 @@
 package routes
 
 import (
+	"time"
+
 	"blogapp/controllers"
 	"blogapp/middleware"
+	"blogapp/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Maximum auth age for routes behind RequireRecentAuth
+const (
+	recentAuth       = 10 * time.Minute
+	recentAuthStrict = 5 * time.Minute
+)
+
 func Register(r *gin.Engine) {
+	r.GET("/.well-known/jwks.json", controllers.JWKS)
+
 	auth := r.Group("/auth")
 	{
 		auth.POST("/register", controllers.Register)
 		auth.POST("/login", controllers.Login)
 		auth.POST("/verify-otp", controllers.VerifyOTP)
+		auth.POST("/resend-otp", controllers.ResendOTP)
 		auth.POST("/forgot-password", controllers.ForgotPassword)
 		auth.POST("/reset-password", controllers.ResetPassword)
-		auth.GET("/me", middleware.AuthRequired(), controllers.Me)
+		auth.POST("/change-password", middleware.AuthRequired(), middleware.SessionOnly(), middleware.RequireRecentAuth(recentAuth), controllers.ChangePassword)
+		auth.POST("/refresh", controllers.Refresh)
+		auth.POST("/magic-link", controllers.RequestMagicLink)
+		auth.POST("/magic-link/consume", controllers.ConsumeMagicLink)
+		auth.POST("/login-alert/deny", controllers.DenyLogin)
+		auth.POST("/logout", middleware.AuthRequired(), middleware.SessionOnly(), controllers.Logout)
+		auth.POST("/logout-all", middleware.AuthRequired(), middleware.SessionOnly(), middleware.RequireRecentAuth(recentAuth), controllers.LogoutAll)
+		auth.POST("/reauth", middleware.AuthRequired(), middleware.SessionOnly(), controllers.Reauth)
+		auth.POST("/reauth/otp", middleware.AuthRequired(), middleware.SessionOnly(), controllers.ReauthOTP)
+		auth.GET("/sessions", middleware.AuthRequired(), middleware.SessionOnly(), controllers.GetSessions)
+		auth.DELETE("/sessions/:id", middleware.AuthRequired(), middleware.SessionOnly(), controllers.DeleteSession)
+		auth.POST("/2fa/setup", middleware.AuthRequired(), middleware.SessionOnly(), middleware.RequireRecentAuth(recentAuth), controllers.Setup2FA)
+		auth.POST("/2fa/confirm", middleware.AuthRequired(), middleware.SessionOnly(), middleware.RequireRecentAuth(recentAuth), controllers.Confirm2FA)
+		auth.POST("/2fa/verify", controllers.Verify2FA)
+		auth.POST("/2fa/disable", middleware.AuthRequired(), middleware.SessionOnly(), middleware.RequireRecentAuth(recentAuth), controllers.Disable2FA)
+		auth.POST("/2fa/webauthn/options", controllers.WebAuthn2FAOptions)
+		auth.POST("/2fa/webauthn/verify", controllers.WebAuthn2FAVerify)
+		auth.POST("/webauthn/register/options", middleware.AuthRequired(), middleware.SessionOnly(), middleware.RequireRecentAuth(recentAuth), controllers.WebAuthnRegisterOptions)
+		auth.POST("/webauthn/register/verify", middleware.AuthRequired(), middleware.SessionOnly(), middleware.RequireRecentAuth(recentAuth), controllers.WebAuthnRegisterVerify)
+		auth.GET("/webauthn/credentials", middleware.AuthRequired(), middleware.SessionOnly(), controllers.GetWebAuthnCredentials)
+		auth.DELETE("/webauthn/credentials/:id", middleware.AuthRequired(), middleware.SessionOnly(), middleware.RequireRecentAuth(recentAuth), controllers.DeleteWebAuthnCredential)
+		auth.POST("/webauthn/login/options", controllers.WebAuthnLoginOptions)
+		auth.POST("/webauthn/login/verify", controllers.WebAuthnLoginVerify)
+		auth.GET("/oidc/:provider/login", controllers.OIDCLogin)
+		auth.GET("/oidc/:provider/callback", controllers.OIDCCallback)
+		auth.GET("/tokens", middleware.AuthRequired(), middleware.SessionOnly(), controllers.GetTokens)
+		auth.POST("/tokens", middleware.AuthRequired(), middleware.SessionOnly(), middleware.RequireRecentAuth(recentAuth), controllers.CreateToken)
+		auth.DELETE("/tokens", middleware.AuthRequired(), middleware.SessionOnly(), middleware.RequireRecentAuth(recentAuth), controllers.DeleteAllTokens)
+		auth.DELETE("/tokens/:id", middleware.AuthRequired(), middleware.SessionOnly(), controllers.DeleteToken)
+		auth.GET("/me", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeProfileRead), controllers.Me)
+		auth.DELETE("/me", middleware.AuthRequired(), middleware.SessionOnly(), middleware.RequireRecentAuth(recentAuthStrict), controllers.DeleteMe)
+		auth.GET("/me/export", middleware.AuthRequired(), middleware.SessionOnly(), controllers.ExportMe)
+		auth.GET("/me/stats", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeProfileRead), controllers.GetMyStats)
+		auth.GET("/me/logins", middleware.AuthRequired(), middleware.SessionOnly(), controllers.GetMyLogins)
+		auth.GET("/me/blocks", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeProfileRead), controllers.GetMyBlocks)
+		auth.GET("/me/mutes", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeProfileRead), controllers.GetMyMutes)
+		auth.PUT("/me", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeProfileWrite), controllers.UpdateMe)
+		auth.PUT("/me/avatar", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeProfileWrite), controllers.UploadAvatar)
+		auth.DELETE("/me/avatar", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeProfileWrite), controllers.DeleteAvatar)
+		auth.PUT("/me/cover", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeProfileWrite), controllers.UploadCover)
+		auth.DELETE("/me/cover", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeProfileWrite), controllers.DeleteCover)
+		auth.PUT("/me/privacy", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeProfileWrite), controllers.UpdatePrivacy)
+		auth.POST("/me/email", middleware.AuthRequired(), middleware.SessionOnly(), middleware.RequireRecentAuth(recentAuth), controllers.RequestEmailChange)
+		auth.POST("/me/email/confirm", middleware.AuthRequired(), middleware.SessionOnly(), controllers.ConfirmEmailChange)
+		auth.POST("/me/phone", middleware.AuthRequired(), middleware.SessionOnly(), middleware.RequireRecentAuth(recentAuth), controllers.RequestPhoneChange)
+		auth.POST("/me/phone/confirm", middleware.AuthRequired(), middleware.SessionOnly(), controllers.ConfirmPhoneChange)
 		auth.GET("/user/:id", controllers.GetUserByID)
 	}
 
+	users := r.Group("/users")
+	{
+		users.GET("/:ref", controllers.GetProfile)
+		users.GET("/:ref/blogs", middleware.OptionalAuth(), controllers.GetUserBlogs)
+		users.GET("/:ref/followers", controllers.GetFollowers)
+		users.GET("/:ref/following", controllers.GetFollowing)
+		users.POST("/:ref/follow", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeFollowsWrite), controllers.FollowUser)
+		users.DELETE("/:ref/follow", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeFollowsWrite), controllers.UnfollowUser)
+		users.POST("/:ref/block", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeBlocksWrite), controllers.BlockUser)
+		users.DELETE("/:ref/block", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeBlocksWrite), controllers.UnblockUser)
+		users.POST("/:ref/mute", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeBlocksWrite), controllers.MuteUser)
+		users.DELETE("/:ref/mute", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeBlocksWrite), controllers.UnmuteUser)
+	}
+
+	r.GET("/feed", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeFeedRead), controllers.GetFeed)
+
+	notifications := r.Group("/notifications", middleware.AuthRequired())
+	{
+		notifications.GET("", middleware.RequireScope(utils.ScopeNotificationsRead), controllers.GetNotifications)
+		notifications.GET("/unread-count", middleware.RequireScope(utils.ScopeNotificationsRead), controllers.GetUnreadNotificationCount)
+		notifications.POST("/read-all", middleware.RequireScope(utils.ScopeNotificationsWrite), controllers.MarkAllNotificationsRead)
+		notifications.POST("/:id/read", middleware.RequireScope(utils.ScopeNotificationsWrite), controllers.MarkNotificationRead)
+		notifications.GET("/preferences", middleware.RequireScope(utils.ScopeNotificationsRead), controllers.GetNotificationPreferences)
+		notifications.PUT("/preferences", middleware.RequireScope(utils.ScopeNotificationsWrite), controllers.UpdateNotificationPreferences)
+	}
+
 	blogs := r.Group("/blogs")
 	{
-		blogs.GET("", controllers.GetBlogs)
-		blogs.GET("/:id", controllers.GetBlog)
-		blogs.POST("", middleware.AuthRequired(), controllers.CreateBlog)
-		blogs.PUT("/:id", middleware.AuthRequired(), controllers.UpdateBlog)
-		blogs.DELETE("/:id", middleware.AuthRequired(), controllers.DeleteBlog)
+		blogs.GET("", middleware.OptionalAuth(), controllers.GetBlogs)
+		blogs.GET("/:id", middleware.OptionalAuth(), controllers.GetBlog)
+		blogs.POST("", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeBlogsWrite), middleware.RequirePermission(utils.PermBlogsCreate), controllers.CreateBlog)
+		blogs.PUT("/:id", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeBlogsWrite), controllers.UpdateBlog)
+		blogs.DELETE("/:id", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeBlogsWrite), controllers.DeleteBlog)
 	
-		blogs.GET("/:id/comments", controllers.GetComments)
-		blogs.POST("/:id/comments", middleware.AuthRequired(), controllers.AddComment)
+		blogs.GET("/:id/comments", middleware.OptionalAuth(), controllers.GetComments)
+		blogs.POST("/:id/comments", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeCommentsWrite), middleware.RequirePermission(utils.PermCommentsCreate), controllers.AddComment)
 
-		blogs.POST("/:id/like", middleware.AuthRequired(), controllers.ToggleLike)
+		blogs.POST("/:id/like", middleware.AuthRequired(), middleware.RequireScope(utils.ScopeLikesWrite), middleware.RequirePermission(utils.PermLikesCreate), controllers.ToggleLike)
+	}
+
+	admin := r.Group("/admin", middleware.AuthRequired(), middleware.SessionOnly())
+	{
+		admin.GET("/users", middleware.RequirePermission(utils.PermUsersRead), controllers.AdminListUsers)
+		admin.GET("/users/:id", middleware.RequirePermission(utils.PermUsersRead), controllers.AdminGetUser)
+		admin.PUT("/users/:id/role", middleware.RequirePermission(utils.PermUsersManage), controllers.AdminUpdateRole)
+		admin.POST("/users/:id/logout", middleware.RequirePermission(utils.PermUsersManage), controllers.AdminRevokeSessions)
+		admin.GET("/security-events", middleware.RequirePermission(utils.PermSecurityRead), controllers.AdminSecurityEvents)
+		admin.GET("/audit-events", middleware.RequirePermission(utils.PermAuditRead), controllers.AdminAuditEvents)
+		admin.GET("/invites", middleware.RequirePermission(utils.PermInvitesManage), controllers.AdminListInvites)
+		admin.POST("/invites", middleware.RequirePermission(utils.PermInvitesManage), controllers.AdminCreateInvite)
+		admin.DELETE("/invites/:id", middleware.RequirePermission(utils.PermInvitesManage), controllers.AdminRevokeInvite)
 	}
 }
@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"blogapp/config"
+	"blogapp/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// activeSessions is a database/sql driver that counts 1 for every COUNT
+// query, which is all AuthRequired needs to find the token's session
+// active. Other queries find nothing and statements do nothing.
+type activeSessions struct{}
+
+func (activeSessions) Open(string) (driver.Conn, error) { return activeConn{}, nil }
+
+type activeConn struct{}
+
+func (activeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (activeConn) Close() error                        { return nil }
+func (activeConn) Begin() (driver.Tx, error)           { return activeConn{}, nil }
+func (activeConn) Commit() error                       { return nil }
+func (activeConn) Rollback() error                     { return nil }
+
+func (activeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	return &countRow{done: !strings.HasPrefix(query, "SELECT count(")}, nil
+}
+
+func (activeConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+type countRow struct{ done bool }
+
+func (*countRow) Columns() []string { return []string{"count"} }
+func (*countRow) Close() error      { return nil }
+
+func (r *countRow) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+func init() {
+	sql.Register("active-sessions", activeSessions{})
+}
+
+// setup registers the routes against a fake database and returns a way to
+// mint access tokens for session 1 of user 1.
+func setup(t *testing.T) (*gin.Engine, func(authTime time.Time) string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	sqlDB, err := sql.Open("active-sessions", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := utils.NewKeyring("blogify-test", "blogify-test")
+	keys.Add(&utils.SigningKey{ID: "test", Method: jwt.SigningMethodEdDSA, Private: priv, Public: pub})
+	if err := keys.SetActive("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	prevDB, prevKeys := config.DB, config.Keys
+	config.DB, config.Keys = db, keys
+	t.Cleanup(func() { config.DB, config.Keys = prevDB, prevKeys })
+
+	r := gin.New()
+	Register(r)
+	return r, func(authTime time.Time) string {
+		tok, err := utils.GenerateJWT(keys, 1, 1, "user", nil, 15*time.Minute, authTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+}
+
+// Routes that add a credential to the account must not be reachable with
+// nothing more than a stolen access token.
+func TestCredentialRoutesRequireRecentAuth(t *testing.T) {
+	r, token := setup(t)
+	stale := token(time.Now().Add(-recentAuth - time.Minute))
+
+	routes := []struct{ method, path string }{
+		{http.MethodPost, "/auth/change-password"},
+		{http.MethodPost, "/auth/webauthn/register/options"},
+		{http.MethodPost, "/auth/webauthn/register/verify"},
+		{http.MethodDelete, "/auth/webauthn/credentials/1"},
+		{http.MethodPost, "/auth/2fa/setup"},
+		{http.MethodPost, "/auth/2fa/confirm"},
+		{http.MethodPost, "/auth/2fa/disable"},
+	}
+	for _, rt := range routes {
+		t.Run(rt.method+" "+rt.path, func(t *testing.T) {
+			req := httptest.NewRequest(rt.method, rt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+stale)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			var body struct {
+				ReauthRequired bool `json:"reauth_required"`
+				MaxAge         int  `json:"max_age"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if w.Code != http.StatusUnauthorized || !body.ReauthRequired {
+				t.Fatalf("got %d %s, want 401 with reauth_required", w.Code, w.Body)
+			}
+			if body.MaxAge != int(recentAuth.Seconds()) {
+				t.Fatalf("max_age = %d, want %d", body.MaxAge, int(recentAuth.Seconds()))
+			}
+		})
+	}
+}
+
+// A stale login is fine for routes that don't change credentials.
+func TestStaleTokenStillAuthenticates(t *testing.T) {
+	r, token := setup(t)
+	req := httptest.NewRequest(http.MethodGet, "/auth/webauthn/credentials", nil)
+	req.Header.Set("Authorization", "Bearer "+token(time.Now().Add(-time.Hour)))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s, want 200", w.Code, w.Body)
+	}
+}
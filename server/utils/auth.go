@@ -1,36 +1,169 @@
 package utils
 
 import (
-	"time"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"strconv"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func GenerateJWT(secret string, userID uint) (string, error) {
-	claims := jwt.MapClaims{
-		"sub": userID,
-		"exp": time.Now().Add(24 * time.Hour * 7).Unix(),
-		"iat": time.Now().Unix(),
+// Claims are the claims carried by an access token. AuthTime is when the
+// user last proved who they are: the login for ordinary tokens, the
+// re-authentication for elevated ones.
+type Claims struct {
+	SessionID   uint             `json:"sid"`
+	Role        string           `json:"role"`
+	Permissions []string         `json:"perms,omitempty"`
+	AuthTime    *jwt.NumericDate `json:"auth_time,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// UserID returns the user the token was issued to.
+func (c *Claims) UserID() uint {
+	id, _ := strconv.ParseUint(c.Subject, 10, 64)
+	return uint(id)
+}
+
+func GenerateJWT(keys *Keyring, userID, sessionID uint, role string, perms []string, ttl time.Duration, authTime time.Time) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		SessionID:   sessionID,
+		Role:        role,
+		Permissions: perms,
+		AuthTime:    jwt.NewNumericDate(authTime),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    keys.Issuer,
+			Audience:  jwt.ClaimStrings{keys.Audience},
+			Subject:   strconv.FormatUint(uint64(userID), 10),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	return keys.Sign(claims)
+}
+
+func ParseJWT(keys *Keyring, token string) (*Claims, error) {
+	claims := &Claims{}
+	if err := keys.Parse(token, claims); err != nil {
+		return nil, err
+	}
+	if claims.UserID() == 0 || claims.SessionID == 0 {
+		return nil, errors.New("invalid claims")
+	}
+	return claims, nil
+}
+
+// PATPrefix marks personal access tokens so they can be told apart from
+// JWTs (and spotted by secret scanners).
+const PATPrefix = "blg_pat_"
+
+// GenerateToken returns a random, URL-safe opaque token.
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return t.SignedString([]byte(secret))
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the SHA-256 of an opaque token, hex encoded. Opaque
+// tokens have enough entropy that an unkeyed hash is sufficient.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ChallengeClaims are carried by short-lived tokens that prove one step of a
+// multi-step flow (e.g. the password step of a 2FA login). They have no
+// session id, so they are never accepted as access tokens.
+type ChallengeClaims struct {
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+func GenerateChallengeToken(keys *Keyring, userID uint, purpose string, ttl time.Duration) (string, error) {
+	return signChallenge(keys, userID, purpose, "", ttl)
 }
 
-func ParseJWT(secret, token string) (uint, error) {
-	t, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
-		return []byte(secret), nil
-	})
-	if err != nil || !t.Valid {
-		return 0, errors.New("invalid token")
+// ParseChallengeToken verifies a challenge token issued for purpose and
+// returns the user it was issued to.
+func ParseChallengeToken(keys *Keyring, token, purpose string) (uint, error) {
+	id, _, err := parseChallenge(keys, token, purpose)
+	return id, err
+}
+
+const MagicLinkPurpose = "magic_link"
+
+// GenerateMagicLinkToken issues the token embedded in a login link. nonce
+// becomes the jti, which the server keeps to make the link single-use.
+func GenerateMagicLinkToken(keys *Keyring, userID uint, nonce string, ttl time.Duration) (string, error) {
+	return signChallenge(keys, userID, MagicLinkPurpose, nonce, ttl)
+}
+
+// ParseMagicLinkToken verifies a login link token and returns its user and
+// nonce.
+func ParseMagicLinkToken(keys *Keyring, token string) (uint, string, error) {
+	id, nonce, err := parseChallenge(keys, token, MagicLinkPurpose)
+	if err == nil && nonce == "" {
+		err = errors.New("invalid claims")
+	}
+	return id, nonce, err
+}
+
+const LoginAlertPurpose = "login_alert"
+
+// GenerateLoginAlertToken issues the token behind the "this wasn't me" link
+// of a new-device login alert. The session is carried in the jti.
+func GenerateLoginAlertToken(keys *Keyring, userID, sessionID uint, ttl time.Duration) (string, error) {
+	return signChallenge(keys, userID, LoginAlertPurpose, strconv.FormatUint(uint64(sessionID), 10), ttl)
+}
+
+// ParseLoginAlertToken verifies a login alert token and returns its user
+// and session.
+func ParseLoginAlertToken(keys *Keyring, token string) (uint, uint, error) {
+	id, jti, err := parseChallenge(keys, token, LoginAlertPurpose)
+	if err != nil {
+		return 0, 0, err
+	}
+	sid, err := strconv.ParseUint(jti, 10, 64)
+	if err != nil || sid == 0 {
+		return 0, 0, errors.New("invalid claims")
+	}
+	return id, uint(sid), nil
+}
+
+func signChallenge(keys *Keyring, userID uint, purpose, jti string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := ChallengeClaims{
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    keys.Issuer,
+			Audience:  jwt.ClaimStrings{keys.Audience},
+			Subject:   strconv.FormatUint(uint64(userID), 10),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
+		},
+	}
+	return keys.Sign(claims)
+}
+
+func parseChallenge(keys *Keyring, token, purpose string) (uint, string, error) {
+	claims := &ChallengeClaims{}
+	if err := keys.Parse(token, claims); err != nil {
+		return 0, "", err
+	}
+	if claims.Purpose != purpose {
+		return 0, "", errors.New("invalid token purpose")
 	}
-	if claims, ok := t.Claims.(jwt.MapClaims); ok {
-		if sub, ok := claims["sub"].(float64); ok {
-			return uint(sub), nil
-		}
+	id, _ := strconv.ParseUint(claims.Subject, 10, 64)
+	if id == 0 {
+		return 0, "", errors.New("invalid claims")
 	}
-	return 0, errors.New("invalid claims")
+	return uint(id), claims.ID, nil
 }
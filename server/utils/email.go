@@ -0,0 +1,54 @@
+package utils
+
+import (
+	_ "embed"
+	"strings"
+)
+
+//go:embed disposable_domains.txt
+var disposableList string
+
+var disposableDomains = func() map[string]bool {
+	m := map[string]bool{}
+	for _, line := range strings.Split(disposableList, "\n") {
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line != "" && !strings.HasPrefix(line, "#") {
+			m[line] = true
+		}
+	}
+	return m
+}()
+
+// EmailDomain returns the lowercased domain of an email address.
+func EmailDomain(email string) string {
+	i := strings.LastIndexByte(email, '@')
+	if i < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(email[i+1:]), "."))
+}
+
+// DomainMatches reports whether domain is one of domains or a subdomain of
+// one of them.
+func DomainMatches(domain string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDisposableEmail reports whether email belongs to a throwaway mailbox
+// provider from the bundled list.
+func IsDisposableEmail(email string) bool {
+	domain := EmailDomain(email)
+	for domain != "" {
+		if disposableDomains[domain] {
+			return true
+		}
+		_, domain, _ = strings.Cut(domain, ".")
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{2,29}$`)
+
+// Handles that would be confusing or could pass for staff, a system page or
+// a route
+var reservedHandles = map[string]bool{
+	"about": true, "account": true, "admin": true, "administrator": true,
+	"api": true, "auth": true, "blog": true, "blogify": true, "blogs": true,
+	"contact": true, "dashboard": true, "delete": true, "edit": true,
+	"explore": true, "feed": true, "help": true, "login": true, "logout": true,
+	"me": true, "mod": true, "moderator": true, "new": true, "notifications": true,
+	"null": true, "official": true, "privacy": true, "register": true,
+	"root": true, "search": true, "security": true, "settings": true,
+	"signup": true, "staff": true, "support": true, "system": true,
+	"terms": true, "undefined": true, "user": true, "users": true, "www": true,
+}
+
+// NormalizeHandle strips whitespace and a leading "@".
+func NormalizeHandle(handle string) string {
+	return strings.TrimPrefix(strings.TrimSpace(handle), "@")
+}
+
+// CheckHandle returns why handle can't be used, or "" if it can. Handles
+// are 3-30 letters, digits and underscores starting with a letter, and are
+// compared case-insensitively.
+func CheckHandle(handle string) string {
+	if !handlePattern.MatchString(handle) {
+		return "must be 3-30 letters, digits or underscores and start with a letter"
+	}
+	if reservedHandles[strings.ToLower(handle)] {
+		return "is reserved"
+	}
+	return ""
+}
+
+// IsWebURL reports whether s is an absolute http or https URL.
+func IsWebURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@/.])@([A-Za-z][A-Za-z0-9_]{2,29})\b`)
+
+// Mentions returns the distinct handles mentioned as "@handle" in text,
+// lowercased, at most max of them. Email addresses and URLs don't count.
+func Mentions(text string, max int) []string {
+	var handles []string
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		h := strings.ToLower(m[1])
+		if seen[h] {
+			continue
+		}
+		seen[h] = true
+		handles = append(handles, h)
+		if len(handles) == max {
+			break
+		}
+	}
+	return handles
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one entry of a Keyring. Private is nil for keys that are
+// only kept to verify tokens signed before a rotation.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// Keyring signs tokens with its active key and verifies them with any key
+// it holds, selected by the token's "kid" header. Keeping the previous keys
+// around after switching the active one lets tokens issued before a
+// rotation stay valid until they expire.
+type Keyring struct {
+	Issuer   string
+	Audience string
+
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+func NewKeyring(issuer, audience string) *Keyring {
+	return &Keyring{Issuer: issuer, Audience: audience, keys: map[string]*SigningKey{}}
+}
+
+// Add puts key on the ring, replacing any key with the same id.
+func (k *Keyring) Add(key *SigningKey) {
+	k.keys[key.ID] = key
+}
+
+// SetActive selects the key new tokens are signed with.
+func (k *Keyring) SetActive(kid string) error {
+	key, ok := k.keys[kid]
+	if !ok {
+		return fmt.Errorf("keyring: unknown key %q", kid)
+	}
+	if key.Private == nil {
+		return fmt.Errorf("keyring: key %q has no private key", kid)
+	}
+	k.active = key
+	return nil
+}
+
+// Sign fills in the issuer and audience and signs claims with the active key.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	if k.active == nil {
+		return "", errors.New("keyring: no active key")
+	}
+	t := jwt.NewWithClaims(k.active.Method, claims)
+	t.Header["kid"] = k.active.ID
+	return t.SignedString(k.active.Private)
+}
+
+// Parse verifies token and decodes it into claims. The signature, expiry,
+// issuer and audience are all checked.
+func (k *Keyring) Parse(token string, claims jwt.Claims) error {
+	t, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := k.keys[kid]
+		if !ok {
+			return nil, errors.New("unknown key id")
+		}
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("invalid signing method")
+		}
+		return key.Public, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(k.Issuer),
+		jwt.WithAudience(k.Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !t.Valid {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public half of every key on the ring.
+func (k *Keyring) JWKS() []JWK {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	keys := make([]JWK, 0, len(ids))
+	for _, id := range ids {
+		key := k.keys[id]
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		keys = append(keys, jwk)
+	}
+	return keys
+}
+
+// LoadKeyDir adds every <kid>.pem file in dir to the ring. Private keys
+// (PKCS#8, or PKCS#1 for RSA) can sign and verify; public keys (PKIX) are
+// verify-only, which is how a retired key is kept during a rotation.
+func (k *Keyring) LoadKeyDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		kid := strings.TrimSuffix(filepath.Base(f), ".pem")
+		key, err := ParseSigningKey(kid, data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", f, err)
+		}
+		k.Add(key)
+	}
+	return nil
+}
+
+// ParseSigningKey decodes a PEM encoded RSA or Ed25519 key.
+func ParseSigningKey(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, Private: key, Public: &key.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, Public: key}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, Private: key, Public: key.Public()}, nil
+	case ed25519.PublicKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, Public: key}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", parsed)
+}
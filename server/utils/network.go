@@ -0,0 +1,24 @@
+package utils
+
+import "net/netip"
+
+// IPNetwork returns the network an address belongs to, as a rough stand-in
+// for the client's location: the /24 for IPv4 and the /48 for IPv6, which
+// usually stay the same while a home or office connection changes its
+// address. Unparseable input is returned as is.
+func IPNetwork(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
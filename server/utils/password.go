@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PasswordPolicy decides which new passwords are accepted.
+type PasswordPolicy struct {
+	MinLength  int
+	MinEntropy float64       // estimated bits, see PasswordEntropy
+	Breached   *BreachedList // nil skips the breach check
+}
+
+// Check returns why password is rejected, or nothing when it is fine.
+// personal holds the user's names, email and phone, which the password
+// must not contain.
+func (p PasswordPolicy) Check(password string, personal ...string) []string {
+	var problems []string
+	if len([]rune(password)) < p.MinLength {
+		problems = append(problems, "must be at least "+strconv.Itoa(p.MinLength)+" characters")
+	} else if PasswordEntropy(password) < p.MinEntropy {
+		problems = append(problems, "is too easy to guess; use a longer password or mix in other kinds of characters")
+	}
+	if containsPersonal(password, personal) {
+		problems = append(problems, "must not contain your name, email or phone number")
+	}
+	if p.Breached != nil {
+		found, err := p.Breached.Contains(password)
+		if err != nil {
+			// Fail open: a broken list shouldn't lock everyone out
+			log.Println("breached password check failed:", err)
+		}
+		if found {
+			problems = append(problems, "has appeared in a data breach; choose a different one")
+		}
+	}
+	return problems
+}
+
+// containsPersonal reports whether password contains any of the personal
+// values, or the local part of an email address among them. Very short
+// values are ignored since they'd match by accident.
+func containsPersonal(password string, personal []string) bool {
+	pw := strings.ToLower(password)
+	for _, v := range personal {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if local, _, ok := strings.Cut(v, "@"); ok && len(local) >= 3 && strings.Contains(pw, local) {
+			return true
+		}
+		if len(v) >= 3 && strings.Contains(pw, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// PasswordEntropy estimates the strength of a password in bits, as its
+// length times log2 of the character pool it draws from (lowercase,
+// uppercase, digits, symbols, other). Repeated characters don't count and
+// characters continuing a run like "abc" or "321" count half.
+func PasswordEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	length := 0.0
+	var prev rune
+	for i, r := range []rune(password) {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+
+		switch {
+		case i > 0 && r == prev:
+		case i > 0 && (r == prev+1 || r == prev-1):
+			length += 0.5
+		default:
+			length++
+		}
+		prev = r
+	}
+
+	pool := 0
+	for _, c := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if c.used {
+			pool += c.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	return length * math.Log2(float64(pool))
+}
+
+// BreachedList looks passwords up in a local copy of a breached password
+// list split by hash prefix, the layout of the Pwned Passwords range API:
+// Dir holds one file per 5 character SHA-1 prefix (named "21BD1" or
+// "21BD1.txt"), with "SUFFIX:COUNT" lines. Only the file for the
+// password's prefix is ever read.
+type BreachedList struct {
+	Dir string
+}
+
+func (b *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(b.Dir, prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		f, err = os.Open(filepath.Join(b.Dir, prefix+".txt"))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+	return false, sc.Err()
+}
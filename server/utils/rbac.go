@@ -0,0 +1,85 @@
+package utils
+
+import "slices"
+
+// Roles, from least to most privileged
+const (
+	RoleReader = "reader"
+	RoleAuthor = "author"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// Permissions are "<resource>:<action>" or "<resource>:<action>:<scope>",
+// where scope "own" only covers the user's own records and "any" covers
+// everyone's.
+const (
+	PermBlogsCreate    = "blogs:create"
+	PermBlogsUpdateOwn = "blogs:update:own"
+	PermBlogsUpdateAny = "blogs:update:any"
+	PermBlogsDeleteOwn = "blogs:delete:own"
+	PermBlogsDeleteAny = "blogs:delete:any"
+	PermCommentsCreate = "comments:create"
+	PermLikesCreate    = "likes:create"
+	PermUsersRead      = "users:read"
+	PermUsersManage    = "users:manage"
+	PermSecurityRead   = "security:read"
+	PermAuditRead      = "audit:read"
+	PermInvitesManage  = "invites:manage"
+)
+
+var (
+	readerPerms = []string{PermCommentsCreate, PermLikesCreate}
+	authorPerms = append(slices.Clone(readerPerms), PermBlogsCreate, PermBlogsUpdateOwn, PermBlogsDeleteOwn)
+	editorPerms = append(slices.Clone(authorPerms), PermBlogsUpdateAny, PermBlogsDeleteAny)
+	adminPerms  = append(slices.Clone(editorPerms), PermUsersRead, PermUsersManage, PermSecurityRead, PermAuditRead, PermInvitesManage)
+)
+
+var rolePermissions = map[string][]string{
+	RoleReader: readerPerms,
+	RoleAuthor: authorPerms,
+	RoleEditor: editorPerms,
+	RoleAdmin:  adminPerms,
+}
+
+// AllPermissions lists every permission that can be granted individually.
+var AllPermissions = adminPerms
+
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func ValidPermission(perm string) bool {
+	return slices.Contains(AllPermissions, perm)
+}
+
+// HasPermission reports whether a user with role and the extra grants has
+// perm.
+func HasPermission(role string, extra []string, perm string) bool {
+	return slices.Contains(rolePermissions[role], perm) || slices.Contains(extra, perm)
+}
+
+// Scopes limit what a personal access token can do. They apply on top of
+// the owner's permissions, never instead of them.
+const (
+	ScopeBlogsWrite         = "blogs:write"
+	ScopeCommentsWrite      = "comments:write"
+	ScopeLikesWrite         = "likes:write"
+	ScopeProfileRead        = "profile:read"
+	ScopeProfileWrite       = "profile:write"
+	ScopeFollowsWrite       = "follows:write"
+	ScopeFeedRead           = "feed:read"
+	ScopeBlocksWrite        = "blocks:write"
+	ScopeNotificationsRead  = "notifications:read"
+	ScopeNotificationsWrite = "notifications:write"
+)
+
+var AllScopes = []string{
+	ScopeBlogsWrite, ScopeCommentsWrite, ScopeLikesWrite, ScopeProfileRead, ScopeProfileWrite,
+	ScopeFollowsWrite, ScopeFeedRead, ScopeBlocksWrite, ScopeNotificationsRead, ScopeNotificationsWrite,
+}
+
+func ValidScope(scope string) bool {
+	return slices.Contains(AllScopes, scope)
+}
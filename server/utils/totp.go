@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238 defaults, which every authenticator app supports)
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	totpSkew   = 1 // accept one step before and after to allow for clock drift
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a random 160-bit secret, base32 encoded.
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return b32.EncodeToString(b), nil
+}
+
+// TOTPURI returns the otpauth:// URI authenticator apps scan to enroll.
+func TOTPURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + v.Encode()
+}
+
+// TOTPStep returns the time step t falls in.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// TOTPCode computes the code for a time step (RFC 4226 HOTP with the step
+// as counter).
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := b32.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	m := hmac.New(sha1.New, key)
+	m.Write(msg[:])
+	sum := m.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, bin%1000000), nil
+}
+
+// ValidateTOTP checks code against the steps around now and returns the
+// step that matched. Callers should reject steps at or below the last one
+// they accepted so a code can't be replayed.
+func ValidateTOTP(secret, code string, now time.Time) (int64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	cur := TOTPStep(now)
+	for step := cur - totpSkew; step <= cur+totpSkew; step++ {
+		want, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(want), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateRecoveryCode returns a random code like "k3v9-x2mq-7hpt".
+func GenerateRecoveryCode() (string, error) {
+	const alphabet = "abcdefghijkmnpqrstuvwxyz23456789" // 32 symbols, no l/o/0/1
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for i, c := range b {
+		if i > 0 && i%4 == 0 {
+			sb.WriteByte('-')
+		}
+		sb.WriteByte(alphabet[int(c)%len(alphabet)])
+	}
+	return sb.String(), nil
+}
+
+// NormalizeRecoveryCode strips the formatting users tend to add or drop
+// when typing a recovery code.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// HashRecoveryCode returns the hash a recovery code is stored under. The
+// codes carry 60 random bits, so like opaque tokens they need no key, and
+// they outlive any rotation of OTP_SECRET.
+func HashRecoveryCode(code string) string {
+	return HashToken(NormalizeRecoveryCode(code))
+}
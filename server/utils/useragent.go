@@ -0,0 +1,54 @@
+package utils
+
+import "strings"
+
+// DeviceLabel turns a User-Agent header into a short human readable label
+// such as "Chrome on Windows". It only knows the common browsers and
+// platforms; anything else falls back to "Unknown device".
+func DeviceLabel(ua string) string {
+	browser := ""
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "OPR/"), strings.Contains(ua, "Opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/"), strings.Contains(ua, "CriOS/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	case strings.HasPrefix(ua, "curl/"):
+		browser = "curl"
+	case strings.HasPrefix(ua, "PostmanRuntime/"):
+		browser = "Postman"
+	}
+
+	platform := ""
+	switch {
+	case strings.Contains(ua, "iPhone"):
+		platform = "iPhone"
+	case strings.Contains(ua, "iPad"):
+		platform = "iPad"
+	case strings.Contains(ua, "Android"):
+		platform = "Android"
+	case strings.Contains(ua, "Windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "Mac OS X"), strings.Contains(ua, "Macintosh"):
+		platform = "macOS"
+	case strings.Contains(ua, "CrOS"):
+		platform = "ChromeOS"
+	case strings.Contains(ua, "Linux"):
+		platform = "Linux"
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	}
+	return "Unknown device"
+}
@@ -0,0 +1,127 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// A minimal CBOR (RFC 8949) decoder, covering what authenticators put in
+// attestation objects and COSE keys: integers, byte and text strings,
+// arrays, maps and the simple values. Indefinite lengths, tags and floats
+// aren't used there and are rejected.
+
+var errCBOR = errors.New("webauthn: malformed CBOR")
+
+const maxCBORDepth = 16
+
+// decodeCBOR decodes the first item in data and returns it along with the
+// bytes that follow it. Integers decode to int64, byte strings to []byte,
+// text to string, arrays to []interface{} and maps to
+// map[interface{}]interface{}.
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeItem(data, 0)
+}
+
+func decodeItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, errCBOR
+	}
+	if len(data) == 0 {
+		return nil, nil, errCBOR
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22, 23:
+			return nil, data, nil
+		}
+		return nil, nil, fmt.Errorf("webauthn: unsupported CBOR simple value %d", info)
+	}
+
+	n, data, err := readArg(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if n > 1<<63-1 {
+			return nil, nil, errCBOR
+		}
+		return int64(n), data, nil
+	case 1:
+		if n > 1<<63-1 {
+			return nil, nil, errCBOR
+		}
+		return -1 - int64(n), data, nil
+	case 2, 3:
+		if uint64(len(data)) < n {
+			return nil, nil, errCBOR
+		}
+		b := data[:n]
+		if major == 3 {
+			return string(b), data[n:], nil
+		}
+		return append([]byte(nil), b...), data[n:], nil
+	case 4:
+		// every item takes at least one byte, which bounds the allocation
+		if uint64(len(data)) < n {
+			return nil, nil, errCBOR
+		}
+		arr := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			var v interface{}
+			if v, data, err = decodeItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, data, nil
+	case 5:
+		if uint64(len(data)) < 2*n {
+			return nil, nil, errCBOR
+		}
+		m := make(map[interface{}]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			var k, v interface{}
+			if k, data, err = decodeItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errCBOR
+			}
+			if v, data, err = decodeItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			m[k] = v
+		}
+		return m, data, nil
+	}
+	return nil, nil, fmt.Errorf("webauthn: unsupported CBOR major type %d", major)
+}
+
+// readArg reads the argument that follows an initial byte.
+func readArg(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	}
+	return 0, nil, errCBOR
+}
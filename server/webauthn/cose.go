@@ -0,0 +1,91 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// COSE algorithm identifiers we accept, in order of preference.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+var SupportedAlgorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+var errUnsupportedKey = errors.New("webauthn: unsupported public key")
+
+// PublicKey is a credential public key decoded from its COSE_Key form.
+type PublicKey struct {
+	Alg int
+	Key crypto.PublicKey
+}
+
+// ParsePublicKey decodes a COSE_Key (RFC 9053) as stored for a credential.
+func ParsePublicKey(cose []byte) (*PublicKey, error) {
+	v, _, err := decodeCBOR(cose)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errUnsupportedKey
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == AlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, errUnsupportedKey
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errUnsupportedKey
+		}
+		return &PublicKey{Alg: AlgES256, Key: pub}, nil
+
+	case kty == 1 && alg == AlgEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, errUnsupportedKey
+		}
+		return &PublicKey{Alg: AlgEdDSA, Key: ed25519.PublicKey(x)}, nil
+
+	case kty == 3 && alg == AlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, errUnsupportedKey
+		}
+		exp := int(new(big.Int).SetBytes(e).Int64())
+		return &PublicKey{Alg: AlgRS256, Key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}}, nil
+	}
+	return nil, errUnsupportedKey
+}
+
+// Verify checks sig over data.
+func (k *PublicKey) Verify(data, sig []byte) bool {
+	switch pub := k.Key.(type) {
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(pub, sum[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, data, sig)
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) == nil
+	}
+	return false
+}
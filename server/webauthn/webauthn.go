@@ -0,0 +1,380 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"blogapp/config"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+	flagExtensionData    = 0x80
+)
+
+var (
+	ErrVerification = errors.New("webauthn: verification failed")
+	// ErrClonedCredential means the signature counter went backwards, which
+	// suggests the authenticator was cloned.
+	ErrClonedCredential = errors.New("webauthn: signature counter did not increase")
+)
+
+// RelyingParty is this server as WebAuthn sees it. ID is the domain
+// credentials are scoped to and Origins the frontends allowed to use them.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// RP is set up by Init.
+var RP *RelyingParty
+
+// Init builds RP from config.C. It must be called after config.Load.
+func Init() {
+	RP = &RelyingParty{
+		ID:      config.C.WebAuthnRPID,
+		Name:    config.C.AppName,
+		Origins: config.C.WebAuthnOrigins,
+	}
+}
+
+// NewChallenge returns a random challenge, base64url encoded as it appears
+// in the options and the client data.
+func NewChallenge() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Bytes is binary data that travels as base64url in JSON, as produced by
+// PublicKeyCredential.toJSON() in the browser.
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	dec, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = dec
+	return nil
+}
+
+// ===============================
+// Options sent to the browser
+// ===============================
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         Bytes    `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type CreationOptions struct {
+	RP struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          Bytes  `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	Challenge        string `json:"challenge"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int                    `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+const timeoutMillis = 5 * 60 * 1000
+
+// CreationOptions returns the options for navigator.credentials.create().
+// Credentials the user already has are excluded so the same authenticator
+// isn't registered twice. Attestation isn't requested: any authenticator
+// is accepted.
+func (rp *RelyingParty) CreationOptions(challenge string, userHandle []byte, name, displayName string, exclude []CredentialDescriptor) CreationOptions {
+	var o CreationOptions
+	o.RP.ID, o.RP.Name = rp.ID, rp.Name
+	o.User.ID, o.User.Name, o.User.DisplayName = userHandle, name, displayName
+	o.Challenge = challenge
+	for _, alg := range SupportedAlgorithms {
+		o.PubKeyCredParams = append(o.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int    `json:"alg"`
+		}{"public-key", alg})
+	}
+	o.Timeout = timeoutMillis
+	o.ExcludeCredentials = exclude
+	if o.ExcludeCredentials == nil {
+		o.ExcludeCredentials = []CredentialDescriptor{}
+	}
+	o.AuthenticatorSelection.ResidentKey = "preferred"
+	o.AuthenticatorSelection.UserVerification = "preferred"
+	o.Attestation = "none"
+	return o
+}
+
+// RequestOptions returns the options for navigator.credentials.get(). An
+// empty allow list lets the user pick any passkey for this site.
+func (rp *RelyingParty) RequestOptions(challenge string, allow []CredentialDescriptor, userVerification string) RequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          timeoutMillis,
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+// ===============================
+// Responses from the browser
+// ===============================
+
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId" binding:"required"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes    `json:"clientDataJSON" binding:"required"`
+		AttestationObject Bytes    `json:"attestationObject" binding:"required"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId" binding:"required"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON" binding:"required"`
+		AuthenticatorData Bytes `json:"authenticatorData" binding:"required"`
+		Signature         Bytes `json:"signature" binding:"required"`
+		UserHandle        Bytes `json:"userHandle"`
+	} `json:"response"`
+}
+
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// ParseClientData decodes clientDataJSON. Its challenge is how a response
+// is matched to the options it answers.
+func ParseClientData(raw []byte) (*ClientData, error) {
+	var cd ClientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, fmt.Errorf("webauthn: client data: %w", err)
+	}
+	return &cd, nil
+}
+
+func (rp *RelyingParty) checkClientData(raw []byte, typ, challenge string) error {
+	cd, err := ParseClientData(raw)
+	if err != nil {
+		return err
+	}
+	if cd.Type != typ {
+		return fmt.Errorf("%w: client data type %q", ErrVerification, cd.Type)
+	}
+	if subtle.ConstantTimeCompare([]byte(cd.Challenge), []byte(challenge)) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrVerification)
+	}
+	if cd.CrossOrigin || !slices.Contains(rp.Origins, cd.Origin) {
+		return fmt.Errorf("%w: origin %q not allowed", ErrVerification, cd.Origin)
+	}
+	return nil
+}
+
+// authenticatorData is the parsed authData structure.
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte // COSE_Key
+}
+
+func parseAuthenticatorData(b []byte) (*authenticatorData, error) {
+	if len(b) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrVerification)
+	}
+	ad := &authenticatorData{
+		RPIDHash:  b[:32],
+		Flags:     b[32],
+		SignCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	rest := b[37:]
+
+	if ad.Flags&flagAttestedCredData != 0 {
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data too short", ErrVerification)
+		}
+		ad.AAGUID = rest[:16]
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < n {
+			return nil, fmt.Errorf("%w: credential id too short", ErrVerification)
+		}
+		ad.CredentialID, rest = rest[:n], rest[n:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+		ad.PublicKey, rest = rest[:len(rest)-len(after)], after
+	}
+	if ad.Flags&flagExtensionData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing authenticator data", ErrVerification)
+	}
+	return ad, nil
+}
+
+func (rp *RelyingParty) checkAuthenticatorData(ad *authenticatorData, requireUV bool) error {
+	want := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.RPIDHash, want[:]) {
+		return fmt.Errorf("%w: rp id hash mismatch", ErrVerification)
+	}
+	if ad.Flags&flagUserPresent == 0 {
+		return fmt.Errorf("%w: user not present", ErrVerification)
+	}
+	if requireUV && ad.Flags&flagUserVerified == 0 {
+		return fmt.Errorf("%w: user not verified", ErrVerification)
+	}
+	return nil
+}
+
+// Credential is a newly registered public key credential.
+type Credential struct {
+	ID         []byte
+	PublicKey  []byte // COSE_Key, as stored
+	SignCount  uint32
+	AAGUID     []byte
+	Transports []string
+}
+
+// VerifyRegistration checks the response to CreationOptions issued with
+// challenge and returns the new credential. The attestation statement
+// isn't verified since "none" conveyance was requested.
+func (rp *RelyingParty) VerifyRegistration(res *RegistrationResponse, challenge string, requireUV bool) (*Credential, error) {
+	if err := rp.checkClientData(res.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	v, rest, err := decodeCBOR(res.Response.AttestationObject)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := v.(map[interface{}]interface{})
+	if !ok || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrVerification)
+	}
+	raw, _ := obj["authData"].([]byte)
+	ad, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(ad, requireUV); err != nil {
+		return nil, err
+	}
+	if ad.Flags&flagAttestedCredData == 0 {
+		return nil, fmt.Errorf("%w: no credential in attestation", ErrVerification)
+	}
+	if !bytes.Equal(ad.CredentialID, res.RawID) || len(ad.CredentialID) > 1023 {
+		return nil, fmt.Errorf("%w: credential id mismatch", ErrVerification)
+	}
+	if _, err := ParsePublicKey(ad.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:         ad.CredentialID,
+		PublicKey:  ad.PublicKey,
+		SignCount:  ad.SignCount,
+		AAGUID:     ad.AAGUID,
+		Transports: res.Response.Transports,
+	}, nil
+}
+
+// VerifyAssertion checks the response to RequestOptions issued with
+// challenge against a stored credential and returns its new signature
+// counter. With ErrClonedCredential the reported counter is returned too.
+func (rp *RelyingParty) VerifyAssertion(res *AssertionResponse, challenge string, publicKey []byte, storedCount uint32, requireUV bool) (uint32, error) {
+	if err := rp.checkClientData(res.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	ad, err := parseAuthenticatorData(res.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.checkAuthenticatorData(ad, requireUV); err != nil {
+		return 0, err
+	}
+
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(res.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), res.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !key.Verify(signed, res.Response.Signature) {
+		return 0, fmt.Errorf("%w: bad signature", ErrVerification)
+	}
+
+	// Authenticators that don't keep a counter always report 0
+	if (ad.SignCount != 0 || storedCount != 0) && ad.SignCount <= storedCount {
+		return ad.SignCount, ErrClonedCredential
+	}
+	return ad.SignCount, nil
+}
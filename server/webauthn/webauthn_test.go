@@ -0,0 +1,429 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+const (
+	testRPID   = "blogify.test"
+	testOrigin = "https://blogify.test"
+)
+
+func testRP() *RelyingParty {
+	return &RelyingParty{ID: testRPID, Name: "Blogify", Origins: []string{testOrigin}}
+}
+
+// ===============================
+// CBOR encoding for the fake authenticator
+// ===============================
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+}
+
+// encodeCBOR encodes ints, byte and text strings and maps with int or
+// string keys, the subset attestation objects and COSE keys need. Map keys
+// are written in a fixed order so the output is deterministic.
+func encodeCBOR(v interface{}) []byte {
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case map[interface{}]interface{}:
+		keys := make([]interface{}, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		out := cborHead(5, uint64(len(v)))
+		for _, k := range keys {
+			out = append(out, encodeCBOR(k)...)
+			out = append(out, encodeCBOR(v[k])...)
+		}
+		return out
+	}
+	panic(fmt.Sprintf("encodeCBOR: unsupported %T", v))
+}
+
+// ===============================
+// Software authenticator
+// ===============================
+
+type softAuthenticator struct {
+	alg    int
+	ecKey  *ecdsa.PrivateKey
+	edKey  ed25519.PrivateKey
+	credID []byte
+	count  uint32
+}
+
+func newAuthenticator(t *testing.T, alg int) *softAuthenticator {
+	t.Helper()
+	a := &softAuthenticator{alg: alg, credID: make([]byte, 16)}
+	rand.Read(a.credID)
+	var err error
+	switch alg {
+	case AlgES256:
+		a.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, a.edKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		t.Fatalf("unsupported algorithm %d", alg)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	if a.alg == AlgEdDSA {
+		return encodeCBOR(map[interface{}]interface{}{
+			1: 1, 3: AlgEdDSA, -1: 6, -2: []byte(a.edKey.Public().(ed25519.PublicKey)),
+		})
+	}
+	x, y := make([]byte, 32), make([]byte, 32)
+	a.ecKey.X.FillBytes(x)
+	a.ecKey.Y.FillBytes(y)
+	return encodeCBOR(map[interface{}]interface{}{
+		1: 2, 3: AlgES256, -1: 1, -2: x, -3: y,
+	})
+}
+
+func (a *softAuthenticator) sign(data []byte) []byte {
+	if a.alg == AlgEdDSA {
+		return ed25519.Sign(a.edKey, data)
+	}
+	sum := sha256.Sum256(data)
+	sig, err := ecdsa.SignASN1(rand.Reader, a.ecKey, sum[:])
+	if err != nil {
+		panic(err)
+	}
+	return sig
+}
+
+// ceremony describes what the client and authenticator put in a response.
+// Tests start from a valid one and break a single field.
+type ceremony struct {
+	Type      string
+	Challenge string
+	Origin    string
+	RPID      string
+	Flags     byte
+}
+
+func validCeremony(typ, challenge string) ceremony {
+	return ceremony{Type: typ, Challenge: challenge, Origin: testOrigin, RPID: testRPID, Flags: flagUserPresent | flagUserVerified}
+}
+
+func clientDataJSON(cer ceremony) []byte {
+	b, _ := json.Marshal(ClientData{Type: cer.Type, Challenge: cer.Challenge, Origin: cer.Origin})
+	return b
+}
+
+func (a *softAuthenticator) authData(cer ceremony, attested bool) []byte {
+	rpHash := sha256.Sum256([]byte(cer.RPID))
+	flags := cer.Flags
+	if attested {
+		flags |= flagAttestedCredData
+	}
+	ad := append(rpHash[:], flags)
+	ad = binary.BigEndian.AppendUint32(ad, a.count)
+	if attested {
+		ad = append(ad, make([]byte, 16)...) // AAGUID
+		ad = binary.BigEndian.AppendUint16(ad, uint16(len(a.credID)))
+		ad = append(ad, a.credID...)
+		ad = append(ad, a.coseKey()...)
+	}
+	return ad
+}
+
+func (a *softAuthenticator) register(cer ceremony) *RegistrationResponse {
+	res := &RegistrationResponse{RawID: a.credID, Type: "public-key"}
+	res.Response.ClientDataJSON = clientDataJSON(cer)
+	res.Response.AttestationObject = encodeCBOR(map[interface{}]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[interface{}]interface{}{},
+		"authData": a.authData(cer, true),
+	})
+	return res
+}
+
+// assert signs in, advancing the signature counter first.
+func (a *softAuthenticator) assert(cer ceremony) *AssertionResponse {
+	a.count++
+	res := &AssertionResponse{RawID: a.credID, Type: "public-key"}
+	res.Response.ClientDataJSON = clientDataJSON(cer)
+	res.Response.AuthenticatorData = a.authData(cer, false)
+	hash := sha256.Sum256(res.Response.ClientDataJSON)
+	res.Response.Signature = a.sign(append(append([]byte(nil), res.Response.AuthenticatorData...), hash[:]...))
+	return res
+}
+
+func newChallenge(t *testing.T) string {
+	t.Helper()
+	ch, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ch
+}
+
+func registered(t *testing.T, alg int) (*softAuthenticator, *Credential) {
+	t.Helper()
+	a := newAuthenticator(t, alg)
+	ch := newChallenge(t)
+	cred, err := testRP().VerifyRegistration(a.register(validCeremony("webauthn.create", ch)), ch, false)
+	if err != nil {
+		t.Fatalf("registration: %v", err)
+	}
+	return a, cred
+}
+
+var algorithms = []struct {
+	name string
+	alg  int
+}{
+	{"ES256", AlgES256},
+	{"EdDSA", AlgEdDSA},
+}
+
+// ===============================
+// Ceremonies
+// ===============================
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	for _, tc := range algorithms {
+		t.Run(tc.name, func(t *testing.T) {
+			a, cred := registered(t, tc.alg)
+			if !bytes.Equal(cred.ID, a.credID) {
+				t.Fatalf("credential id = %x, want %x", cred.ID, a.credID)
+			}
+			key, err := ParsePublicKey(cred.PublicKey)
+			if err != nil || key.Alg != tc.alg {
+				t.Fatalf("stored key: alg %v, err %v", key, err)
+			}
+
+			stored := cred.SignCount
+			for i := 0; i < 2; i++ {
+				ch := newChallenge(t)
+				count, err := testRP().VerifyAssertion(a.assert(validCeremony("webauthn.get", ch)), ch, cred.PublicKey, stored, true)
+				if err != nil {
+					t.Fatalf("assertion %d: %v", i, err)
+				}
+				if count != a.count {
+					t.Fatalf("assertion %d: count = %d, want %d", i, count, a.count)
+				}
+				stored = count
+			}
+		})
+	}
+}
+
+func TestAssertionRejectsSignCountRegression(t *testing.T) {
+	a, cred := registered(t, AlgES256)
+	ch := newChallenge(t)
+	res := a.assert(validCeremony("webauthn.get", ch)) // count 1
+	count, err := testRP().VerifyAssertion(res, ch, cred.PublicKey, 5, false)
+	if !errors.Is(err, ErrClonedCredential) {
+		t.Fatalf("err = %v, want ErrClonedCredential", err)
+	}
+	if count != 1 {
+		t.Fatalf("count = %d, want the reported 1", count)
+	}
+
+	// Replaying the same counter is a regression too
+	ch = newChallenge(t)
+	res = a.assert(validCeremony("webauthn.get", ch))
+	if _, err := testRP().VerifyAssertion(res, ch, cred.PublicKey, a.count, false); !errors.Is(err, ErrClonedCredential) {
+		t.Fatalf("equal counter: err = %v, want ErrClonedCredential", err)
+	}
+}
+
+func TestAssertionRejectsWrongKey(t *testing.T) {
+	a, _ := registered(t, AlgES256)
+	_, other := registered(t, AlgES256)
+	ch := newChallenge(t)
+	_, err := testRP().VerifyAssertion(a.assert(validCeremony("webauthn.get", ch)), ch, other.PublicKey, 0, false)
+	if !errors.Is(err, ErrVerification) {
+		t.Fatalf("err = %v, want ErrVerification", err)
+	}
+}
+
+// TestRejectedCeremonies breaks one part of an otherwise valid response.
+func TestRejectedCeremonies(t *testing.T) {
+	cases := []struct {
+		name   string
+		mutate func(*ceremony)
+		uv     bool
+	}{
+		{"wrong origin", func(c *ceremony) { c.Origin = "https://evil.test" }, false},
+		{"origin with other port", func(c *ceremony) { c.Origin = testOrigin + ":8443" }, false},
+		{"wrong challenge", func(c *ceremony) { c.Challenge = "not-the-challenge" }, false},
+		{"wrong type", func(c *ceremony) {
+			if c.Type == "webauthn.get" {
+				c.Type = "webauthn.create"
+			} else {
+				c.Type = "webauthn.get"
+			}
+		}, false},
+		{"wrong rp id hash", func(c *ceremony) { c.RPID = "evil.test" }, false},
+		{"user not present", func(c *ceremony) { c.Flags &^= flagUserPresent }, false},
+		{"user not verified", func(c *ceremony) { c.Flags &^= flagUserVerified }, true},
+	}
+
+	for _, tc := range cases {
+		for _, alg := range algorithms {
+			t.Run("registration/"+tc.name+"/"+alg.name, func(t *testing.T) {
+				a := newAuthenticator(t, alg.alg)
+				ch := newChallenge(t)
+				cer := validCeremony("webauthn.create", ch)
+				tc.mutate(&cer)
+				if _, err := testRP().VerifyRegistration(a.register(cer), ch, tc.uv); !errors.Is(err, ErrVerification) {
+					t.Fatalf("err = %v, want ErrVerification", err)
+				}
+			})
+			t.Run("assertion/"+tc.name+"/"+alg.name, func(t *testing.T) {
+				a, cred := registered(t, alg.alg)
+				ch := newChallenge(t)
+				cer := validCeremony("webauthn.get", ch)
+				tc.mutate(&cer)
+				if _, err := testRP().VerifyAssertion(a.assert(cer), ch, cred.PublicKey, 0, tc.uv); !errors.Is(err, ErrVerification) {
+					t.Fatalf("err = %v, want ErrVerification", err)
+				}
+			})
+		}
+	}
+}
+
+func TestRegistrationRejectsMismatchedRawID(t *testing.T) {
+	a := newAuthenticator(t, AlgES256)
+	ch := newChallenge(t)
+	res := a.register(validCeremony("webauthn.create", ch))
+	res.RawID = []byte("some other credential")
+	if _, err := testRP().VerifyRegistration(res, ch, false); !errors.Is(err, ErrVerification) {
+		t.Fatalf("err = %v, want ErrVerification", err)
+	}
+}
+
+func TestRejectsMalformedResponses(t *testing.T) {
+	a := newAuthenticator(t, AlgES256)
+	ch := newChallenge(t)
+	valid := a.register(validCeremony("webauthn.create", ch))
+	attObj := valid.Response.AttestationObject
+
+	for name, obj := range map[string][]byte{
+		"truncated attestation object": attObj[:len(attObj)-10],
+		"trailing bytes":               append(append([]byte(nil), attObj...), 0x00),
+		"not a map":                    encodeCBOR("authData"),
+		"no authData":                  encodeCBOR(map[interface{}]interface{}{"fmt": "none"}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			res := *valid
+			res.Response.AttestationObject = obj
+			if _, err := testRP().VerifyRegistration(&res, ch, false); err == nil {
+				t.Fatal("accepted a malformed attestation object")
+			}
+		})
+	}
+
+	b, cred := registered(t, AlgES256)
+	ch = newChallenge(t)
+	res := b.assert(validCeremony("webauthn.get", ch))
+	res.Response.AuthenticatorData = res.Response.AuthenticatorData[:36]
+	if _, err := testRP().VerifyAssertion(res, ch, cred.PublicKey, 0, false); !errors.Is(err, ErrVerification) {
+		t.Fatalf("short authenticator data: err = %v, want ErrVerification", err)
+	}
+}
+
+// ===============================
+// CBOR decoder
+// ===============================
+
+func TestDecodeCBOR(t *testing.T) {
+	in := map[interface{}]interface{}{1: 2, -3: []byte{0xde, 0xad}, "k": "v", "n": 70000}
+	v, rest, err := decodeCBOR(append(encodeCBOR(in), 0xff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, []byte{0xff}) {
+		t.Fatalf("rest = %x, want ff", rest)
+	}
+	m := v.(map[interface{}]interface{})
+	if m[int64(1)] != int64(2) || !bytes.Equal(m[int64(-3)].([]byte), []byte{0xde, 0xad}) || m["k"] != "v" || m["n"] != int64(70000) {
+		t.Fatalf("decoded %#v", m)
+	}
+}
+
+func TestDecodeCBORRejectsMalformed(t *testing.T) {
+	deep := bytes.Repeat([]byte{0x81}, maxCBORDepth+2) // nested one-element arrays
+	deep = append(deep, 0x00)
+
+	cases := map[string][]byte{
+		"empty":                  {},
+		"truncated argument":     {0x19, 0x01},
+		"truncated byte string":  {0x45, 0x01, 0x02},
+		"truncated text":         {0x78, 0x10, 'a'},
+		"truncated map":          {0xa2, 0x01, 0x02},
+		"oversized byte string":  {0x5a, 0xff, 0xff, 0xff, 0xff, 0x00},
+		"oversized array":        {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00},
+		"oversized map":          {0xbb, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02},
+		"integer overflow":       {0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"too deep":               deep,
+		"indefinite byte string": {0x5f, 0x41, 0x00, 0xff},
+		"tag":                    {0xc0, 0x00},
+		"float":                  {0xf9, 0x3c, 0x00},
+		"byte string map key":    {0xa1, 0x41, 0x00, 0x00},
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			if v, _, err := decodeCBOR(data); err == nil {
+				t.Fatalf("decoded %#v from malformed input", v)
+			}
+		})
+	}
+}
+
+func TestParsePublicKeyRejectsBadKeys(t *testing.T) {
+	cases := map[string]map[interface{}]interface{}{
+		"unknown alg":     {1: 2, 3: -35, -1: 1, -2: make([]byte, 32), -3: make([]byte, 32)},
+		"short EC coords": {1: 2, 3: AlgES256, -1: 1, -2: make([]byte, 31), -3: make([]byte, 32)},
+		"point off curve": {1: 2, 3: AlgES256, -1: 1, -2: make([]byte, 32), -3: make([]byte, 32)},
+		"wrong OKP curve": {1: 1, 3: AlgEdDSA, -1: 4, -2: make([]byte, 32)},
+		"short RSA mod":   {1: 3, 3: AlgRS256, -1: make([]byte, 128), -2: []byte{1, 0, 1}},
+	}
+	for name, key := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParsePublicKey(encodeCBOR(key)); err == nil {
+				t.Fatal("accepted an invalid key")
+			}
+		})
+	}
+}